@@ -0,0 +1,98 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// A line of a batch that couldn't be parsed, reported once the requests
+// read before it have been answered
+type batchParseError struct {
+	before int // number of requests read before the line
+	err    error
+}
+
+// Run commands read one per line from path (or stdin if "-"), pipelined over
+// a single connection, printing responses in order & errors with the line
+// they came from. Blank lines & lines starting with # are skipped. With
+// stopOnError nothing after the first failing command is printed; commands
+// already sent may still be applied. Returns false if any command failed
+func Batch(path string, stopOnError bool) bool {
+	r := openInput(path)
+	defer r.Close()
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	return runBatch(r, w, stopOnError)
+}
+
+// Run a batch read from r, printing responses to out
+func runBatch(r io.Reader, out *bufio.Writer, stopOnError bool) bool {
+	var requests []runtime.Request
+	var lines []int // line of each request in the input
+	var parseErrs []batchParseError
+	failed := false
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+		request, err := runtime.ConstructRequest(args, false)
+		if err != nil {
+			failed = true
+			parseErrs = append(parseErrs, batchParseError{
+				before: len(requests),
+				err:    fmt.Errorf("Line %d: %v", line, err),
+			})
+			if stopOnError {
+				break
+			}
+			continue
+		}
+		requests = append(requests, request)
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	// report the parse errors due before request i; responses are flushed
+	// first so the two keep their order when they share a terminal
+	reportParseErrors := func(i int) {
+		if len(parseErrs) == 0 || parseErrs[0].before > i {
+			return
+		}
+		out.Flush()
+		for len(parseErrs) > 0 && parseErrs[0].before <= i {
+			log.Println(parseErrs[0].err)
+			parseErrs = parseErrs[1:]
+		}
+	}
+	if len(requests) > 0 {
+		completed := pipeline(requests, func(i int, response runtime.Response) bool {
+			reportParseErrors(i)
+			switch response.GetStatus() {
+			case runtime.InvalidRequest, runtime.ServerError, runtime.Failed:
+				out.Flush()
+				log.Printf("Line %d: %s\n", lines[i], response.ErrorMessage())
+				failed = true
+				return !stopOnError
+			case runtime.StreamDone:
+				// don't read stream done to stdout
+			default:
+				fmt.Fprintln(out, response.DataPayload())
+			}
+			return true
+		})
+		if !completed {
+			return false
+		}
+	}
+	reportParseErrors(len(requests))
+	return !failed
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// Run a batch against the server, returning its result & the responses &
+// errors it printed as lines in the order they were printed
+func batchOutput(t *testing.T, input string, stopOnError bool) (bool, []string) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	writer, flags := log.Writer(), log.Flags()
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+	}()
+	out := bufio.NewWriter(buf)
+	ok := runBatch(strings.NewReader(input), out, stopOnError)
+	out.Flush()
+	return ok, strings.Split(strings.TrimSpace(buf.String()), "\n")
+}
+
+// Answer loads with their key, failing any load of "bad"
+func answerKeys(r runtime.Request) []runtime.Response {
+	if r.GetKey() == "bad" {
+		return []runtime.Response{
+			runtime.ConstructResponse(r, runtime.InvalidRequest, "bad key"),
+		}
+	}
+	return []runtime.Response{runtime.ConstructResponse(r, runtime.Ok, r.GetKey())}
+}
+
+// Whether each line starts with the prefix given for it
+func matchLines(lines []string, prefixes ...string) bool {
+	if len(lines) != len(prefixes) {
+		return false
+	}
+	for i, prefix := range prefixes {
+		if !strings.HasPrefix(lines[i], prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBatch(t *testing.T) {
+	// responses come back in groups of window, last request first
+	tests := map[string]struct {
+		window      int
+		input       string
+		stopOnError bool
+		ok          bool
+		output      []string
+	}{
+		"in order": {
+			window: 3,
+			input:  "load a\n\n# skipped\nload b\nload c\n",
+			ok:     true,
+			output: []string{"a", "b", "c"},
+		},
+		"parse errors in place": {
+			window: 3,
+			input:  "load a\nnonsense\nload b\nload c\nfrobnicate\n",
+			output: []string{"a", "Line 2:", "b", "c", "Line 5:"},
+		},
+		"failures in place": {
+			window: 3,
+			input:  "load a\nload bad\nload c\n",
+			output: []string{"a", "Line 2: bad key", "c"},
+		},
+		"stop on parse error": {
+			window:      1,
+			input:       "load a\nnonsense\nload c\n",
+			stopOnError: true,
+			output:      []string{"a", "Line 2:"},
+		},
+		"stop on failure": {
+			window:      3,
+			input:       "load a\nload bad\nload c\n",
+			stopOnError: true,
+			output:      []string{"a", "Line 2: bad key"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			startServer(t, test.window, answerKeys)
+			ok, lines := batchOutput(t, test.input, test.stopOnError)
+			if ok != test.ok || !matchLines(lines, test.output...) {
+				t.Errorf("batch gave %t with output %q", ok, lines)
+			}
+		})
+	}
+}
+
+func TestBatchStopsSendingAtParseError(t *testing.T) {
+	s := startServer(t, 1, answerKeys)
+	batchOutput(t, "load a\nload b\nnonsense\nload c\n", true)
+	if received := len(s.received()); received != 2 {
+		t.Errorf("server sent %d requests; want those before the error", received)
+	}
+}
@@ -1,65 +1,170 @@
 package client
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 
 	"github.com/EnemigoPython/go-getit/src/runtime"
 )
 
-func MakeRequest(request runtime.Request) {
-	conn, err := net.Dial("tcp", runtime.SocketAddress())
+// Read frames from the connection until it is closed by the server
+func readFrames(frames *runtime.FrameReader) <-chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for {
+			// Read the response
+			frame, err := frames.ReadFrame()
+			if err == io.EOF || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			if runtime.Config.Debug {
+				log.Printf("Raw bytes: % x\n", frame)
+			}
+			out <- frame
+		}
+	}()
+	return out
+}
+
+// Offer this client's protocol version & features to the server, failing
+// if it refuses or doesn't agree to the features requests depend on
+func handshake(conn net.Conn, frames *runtime.FrameReader) error {
+	if _, err := conn.Write(runtime.Frame(runtime.NewHello())); err != nil {
+		return err
+	}
+	frame, err := frames.ReadFrame()
+	if err == io.EOF {
+		return errors.New(
+			"server closed the connection during the handshake; " +
+				"it may be out of date",
+		)
+	}
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	hello, err := runtime.DecodeHelloReply(frame)
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
-
-	requestBytes := runtime.Frame(request)
 	if runtime.Config.Debug {
-		log.Printf("Request bytes: % x\n", requestBytes)
+		fmt.Println(hello)
 	}
+	return nil
+}
+
+func MakeRequest(request runtime.Request) {
+	MakeRequests([]runtime.Request{request})
+}
 
-	// Send a message
-	_, err = conn.Write(requestBytes)
+// Send requests over a single connection & print responses in order
+func MakeRequests(requests []runtime.Request) {
+	sendRequests(requests, func(response runtime.Response) {
+		// don't read stream done to stdout
+		if response.GetStatus() != runtime.StreamDone {
+			// read all other responses
+			fmt.Println(response.DataPayload())
+		}
+	})
+}
+
+// Send requests over a single connection & pass each response to handle in
+// the order the requests were made
+func sendRequests(
+	requests []runtime.Request,
+	handle func(runtime.Response),
+) {
+	pipeline(requests, func(_ int, response runtime.Response) bool {
+		handle(response)
+		return true
+	})
+}
+
+// Send requests pipelined over a single connection & pass each response to
+// handle with the index of its request, in the order the requests were made.
+// Returns false if handle stopped it by returning false or the connection
+// closed before every request was answered
+func pipeline(
+	requests []runtime.Request,
+	handle func(int, runtime.Response) bool,
+) bool {
+	conn, err := net.Dial("tcp", runtime.SocketAddress())
 	if err != nil {
 		log.Fatal(err)
 	}
-	if runtime.Config.Debug {
-		fmt.Println(request)
+	defer conn.Close()
+	frames := runtime.NewFrameReader(conn)
+	if err := handshake(conn, frames); err != nil {
+		log.Fatal(err)
 	}
 
-	for {
-		// Read the response
-		buf := make([]byte, 1024)
-		n, err := conn.Read(buf)
-		if err != nil {
-			log.Fatal(err)
-		}
-		rawBytes := buf[:n]
-		if runtime.Config.Debug {
-			log.Printf("Raw bytes: % x\n", rawBytes)
-		}
-		done := false
-		for frame := range runtime.FrameChannel(rawBytes) {
-			response := runtime.DecodeResponse(frame)
+	// write while reading responses so a long pipeline can't fill the
+	// socket buffers both ways
+	go func() {
+		w := bufio.NewWriter(conn)
+		for _, request := range requests {
+			requestBytes := runtime.Frame(request)
 			if runtime.Config.Debug {
-				fmt.Println(response)
+				fmt.Println(request)
+				log.Printf("Request bytes: % x\n", requestBytes)
 			}
-
-			// don't read stream done to stdout
-			if response.GetStatus() != runtime.StreamDone {
-				// read all other responses
-				fmt.Println(response.DataPayload())
+			if _, err := w.Write(requestBytes); err != nil {
+				return // the connection is closed; the reader reports it
 			}
+		}
+		w.Flush()
+	}()
 
-			if !request.IsStream() || response.GetStatus() != runtime.Ok {
-				done = true
+	// responses are matched by id & held back until every earlier request
+	// has been answered, so they may arrive in any order
+	pending := make(map[uint32]int, len(requests))
+	for i, request := range requests {
+		pending[request.GetId()] = i
+	}
+	held := make([][]runtime.Response, len(requests))
+	done := make([]bool, len(requests))
+	next := 0
+	for frame := range readFrames(frames) {
+		response := runtime.DecodeResponse(frame)
+		if runtime.Config.Debug {
+			fmt.Println(response)
+		}
+		i, ok := pending[response.GetId()]
+		if !ok {
+			log.Printf("Response for unknown request %d\n", response.GetId())
+			continue
+		}
+		held[i] = append(held[i], response)
+		if !requests[i].IsStream() || response.EndsStream() {
+			delete(pending, response.GetId())
+			done[i] = true
+		}
+		for next < len(requests) {
+			for _, r := range held[next] {
+				if !handle(next, r) {
+					return false
+				}
+			}
+			held[next] = nil
+			if !done[next] {
 				break
 			}
+			next++
 		}
-		if done {
-			break
+		if next == len(requests) {
+			return true
 		}
 	}
+	log.Printf(
+		"Connection closed with %d requests unanswered\n",
+		len(requests)-next,
+	)
+	return false
 }
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// Stands in for the server, recording the requests it is sent
+type fakeServer struct {
+	mutex    sync.Mutex
+	requests []runtime.Request
+}
+
+func (s *fakeServer) received() []runtime.Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Start a server on a free port & point the client at it. After the
+// handshake it reads requests in groups of window & answers each group last
+// request first with respond, as a server free to reorder responses might.
+// A nil answer from respond hangs up the connection
+func startServer(
+	t *testing.T,
+	window int,
+	respond func(runtime.Request) []runtime.Response,
+) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	runtime.Config.Port = ln.Addr().(*net.TCPAddr).Port
+	s := &fakeServer{}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c, window, respond)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(
+	c net.Conn,
+	window int,
+	respond func(runtime.Request) []runtime.Response,
+) {
+	defer c.Close()
+	frames := runtime.NewFrameReader(c)
+	frame, err := frames.ReadFrame()
+	if err != nil {
+		return
+	}
+	hello, err := runtime.DecodeHello(frame)
+	if err == nil {
+		hello, err = runtime.Negotiate(hello)
+	}
+	if err != nil {
+		return
+	}
+	c.Write(runtime.Frame(hello))
+	var group []runtime.Request
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			return
+		}
+		request, err := runtime.DecodeRequest(frame)
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.requests = append(s.requests, request)
+		s.mutex.Unlock()
+		group = append(group, request)
+		if len(group) < window {
+			continue
+		}
+		for _, r := range slices.Backward(group) {
+			responses := respond(r)
+			if responses == nil {
+				return
+			}
+			for _, response := range responses {
+				c.Write(runtime.Frame(response))
+			}
+		}
+		group = nil
+	}
+}
+
+// Build the request for each command, failing the test if one can't be built
+func constructAll(t *testing.T, commands ...string) []runtime.Request {
+	t.Helper()
+	var requests []runtime.Request
+	for _, command := range commands {
+		request, err := runtime.ConstructRequest(strings.Fields(command), false)
+		if err != nil {
+			t.Fatalf("ConstructRequest(%q): %v", command, err)
+		}
+		requests = append(requests, request)
+	}
+	return requests
+}
+
+func TestPipelineOrdersResponses(t *testing.T) {
+	startServer(t, 3, func(r runtime.Request) []runtime.Response {
+		return []runtime.Response{runtime.ConstructResponse(r, runtime.Ok, r.GetKey())}
+	})
+	requests := constructAll(t, "load a", "load b", "load c", "load d", "load e", "load f")
+	var keys []string
+	completed := pipeline(requests, func(i int, response runtime.Response) bool {
+		keys = append(keys, response.DataPayload())
+		return true
+	})
+	if !completed || strings.Join(keys, "") != "abcdef" {
+		t.Errorf("pipeline completed %t with responses %v", completed, keys)
+	}
+}
+
+func TestPipelineFailsWhenConnectionCloses(t *testing.T) {
+	startServer(t, 1, func(r runtime.Request) []runtime.Response {
+		if r.GetKey() == "c" {
+			return nil
+		}
+		return []runtime.Response{runtime.ConstructResponse(r, runtime.Ok, 1)}
+	})
+	requests := constructAll(t, "load a", "load b", "load c", "load d")
+	handled := 0
+	completed := pipeline(requests, func(int, runtime.Response) bool {
+		handled++
+		return true
+	})
+	if completed || handled != 2 {
+		t.Errorf("pipeline completed %t after %d of 4 responses", completed, handled)
+	}
+}
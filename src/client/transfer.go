@@ -0,0 +1,199 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+const importBatchSize = 500 // records per bulkset request when importing
+
+// Write every entry in the store as JSON Lines to path, or stdout if omitted
+func Export(path string) {
+	var w io.Writer = os.Stdout
+	if path != "" && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	request, err := runtime.ConstructRequest([]string{"export"}, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sendRequests([]runtime.Request{request}, func(response runtime.Response) {
+		if response.GetStatus() != runtime.StreamDone {
+			fmt.Fprintln(bw, response.DataPayload())
+		}
+	})
+}
+
+// Open path for reading, or stdin if "-"
+func openInput(path string) io.ReadCloser {
+	if path == "-" {
+		return io.NopCloser(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return f
+}
+
+// Writes records to the store in bulkset batches as they are read
+type bulkLoader struct {
+	batch    []any // alternating keys & typed values not yet sent
+	imported int
+	created  int // records that were new keys
+}
+
+func (l *bulkLoader) add(key string, value any) {
+	l.batch = append(l.batch, key, value)
+	l.imported++
+	if len(l.batch) == importBatchSize*2 {
+		l.send()
+	}
+}
+
+// Send the records still held as the last batch of the load
+func (l *bulkLoader) finish() {
+	if len(l.batch) > 0 {
+		l.send()
+	}
+}
+
+func (l *bulkLoader) send() {
+	request, err := runtime.NewBulkSetRequest(l.batch)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sendRequests([]runtime.Request{request}, func(response runtime.Response) {
+		n, _ := strconv.Atoi(response.DataPayload())
+		l.created += n
+	})
+	l.batch = nil
+}
+
+// Load JSON Lines from path (or stdin if "-") into the store in batches,
+// reporting lines that cannot be imported without stopping
+func Import(path string) {
+	r := openInput(path)
+	defer r.Close()
+	var loader bulkLoader
+	var failed int
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		key, value, err := runtime.DecodeRecord(text)
+		if err != nil {
+			log.Printf("Line %d: %v\n", line, err)
+			failed++
+			continue
+		}
+		loader.add(key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	loader.finish()
+	fmt.Printf(
+		"imported %d (%d new), failed %d\n",
+		loader.imported,
+		loader.created,
+		failed,
+	)
+}
+
+// Find the index of a CSV column given by number (from 0) or header name
+func csvColumn(column string, header []string) (int, error) {
+	if i, err := strconv.Atoi(column); err == nil && i >= 0 {
+		return i, nil
+	}
+	if i := slices.Index(header, column); i >= 0 {
+		return i, nil
+	}
+	return 0, fmt.Errorf("no CSV column '%s'", column)
+}
+
+// Load the key & value columns of a CSV file (or stdin if "-") into the
+// store in batches, inferring int or string values as the client does &
+// reporting rows that cannot be imported without stopping. The first row is
+// a header if hasHeader is set or either column is given by name
+func ImportCSV(path, keyColumn, valueColumn string, hasHeader bool) {
+	r := openInput(path)
+	defer r.Close()
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // rows are checked for the columns used
+	var header []string
+	_, keyErr := strconv.Atoi(keyColumn)
+	_, valueErr := strconv.Atoi(valueColumn)
+	row := 1
+	if hasHeader || keyErr != nil || valueErr != nil {
+		var err error
+		header, err = reader.Read()
+		if err != nil {
+			log.Fatal(err)
+		}
+		row++
+	}
+	keyIndex, err := csvColumn(keyColumn, header)
+	if err != nil {
+		log.Fatal(err)
+	}
+	valueIndex, err := csvColumn(valueColumn, header)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var loader bulkLoader
+	var failed int
+	for ; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				log.Fatal(err)
+			}
+			log.Printf("Row %d: %v\n", row, err)
+			failed++
+			continue
+		}
+		if keyIndex >= len(fields) || valueIndex >= len(fields) {
+			log.Printf("Row %d: only %d columns\n", row, len(fields))
+			failed++
+			continue
+		}
+		key := fields[keyIndex]
+		value, err := runtime.ParseRecord(key, fields[valueIndex])
+		if err != nil {
+			log.Printf("Row %d: %v\n", row, err)
+			failed++
+			continue
+		}
+		loader.add(key, value)
+	}
+	loader.finish()
+	fmt.Printf(
+		"imported %d (%d new), failed %d\n",
+		loader.imported,
+		loader.created,
+		failed,
+	)
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+func TestBulkLoaderBatches(t *testing.T) {
+	for _, records := range []int{1, importBatchSize, importBatchSize * 2, importBatchSize*2 + 1} {
+		s := startServer(t, 1, func(r runtime.Request) []runtime.Response {
+			return []runtime.Response{
+				runtime.ConstructResponse(r, runtime.Ok, len(r.GetArgs())/2),
+			}
+		})
+		var loader bulkLoader
+		for i := range records {
+			loader.add(fmt.Sprintf("k%d", i), i)
+		}
+		loader.finish()
+		if loader.imported != records || loader.created != records {
+			t.Errorf(
+				"%d records: imported %d, created %d",
+				records,
+				loader.imported,
+				loader.created,
+			)
+		}
+		batches := s.received()
+		wantBatches := (records + importBatchSize - 1) / importBatchSize
+		if len(batches) != wantBatches {
+			t.Fatalf("%d records sent in %d batches", records, len(batches))
+		}
+		for i, batch := range batches {
+			want := min(importBatchSize, records-i*importBatchSize)
+			if len(batch.GetArgs()) != want*2 {
+				t.Errorf("%d records: batch %d holds %d", records, i, len(batch.GetArgs())/2)
+			}
+		}
+	}
+}
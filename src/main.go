@@ -2,11 +2,17 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/EnemigoPython/go-getit/src/client"
 	"github.com/EnemigoPython/go-getit/src/runtime"
 	"github.com/EnemigoPython/go-getit/src/server"
+	"github.com/EnemigoPython/go-getit/src/store"
 )
 
 func main() {
@@ -15,13 +21,60 @@ func main() {
 	storeNameFlag := flag.String("store", "store", "The name of the store file")
 	debugFlag := flag.Bool("debug", false, "Run in debug mode")
 	noLogFlag := flag.Bool("no-log", false, "Set to true to disable file logging")
+	idleTimeoutFlag := flag.Duration(
+		"idle-timeout",
+		5*time.Minute,
+		"How long the server keeps an idle connection open; 0 for no limit",
+	)
+	keyColumnFlag := flag.String(
+		"key-column",
+		"0",
+		"The CSV column (number from 0 or header name) of keys for import-csv",
+	)
+	valueColumnFlag := flag.String(
+		"value-column",
+		"1",
+		"The CSV column (number from 0 or header name) of values for import-csv",
+	)
+	csvHeaderFlag := flag.Bool(
+		"csv-header",
+		false,
+		"Skip the first row of the file for import-csv",
+	)
+	slotsFlag := flag.String(
+		"slots",
+		"",
+		"The range of slots (A-B, A- or -B) for inspect",
+	)
+	patternFlag := flag.String(
+		"pattern",
+		"",
+		"The glob pattern keys must match for inspect",
+	)
+	jsonFlag := flag.Bool("json", false, "Output JSON for inspect")
+	strategyFlag := flag.String(
+		"strategy",
+		"ours",
+		"How merge resolves changed keys: ours, theirs or newest",
+	)
+	stopOnErrorFlag := flag.Bool(
+		"stop-on-error",
+		false,
+		"Stop batch at the first command that fails",
+	)
 	flag.Parse()
+	command, args := flag.Arg(0), flag.Args()
+	if localCommands[command] {
+		// these commands take flags after their arguments too
+		args = append(args[:1:1], parseInterspersed(flag.CommandLine, args[1:])...)
+	}
 	config, err := runtime.ParseConfig(
 		*runTimeFlag,
 		*portFlag,
 		*storeNameFlag,
 		*debugFlag,
 		*noLogFlag,
+		*idleTimeoutFlag,
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -29,11 +82,171 @@ func main() {
 	switch config.RunTime {
 	case runtime.Server:
 		server.Run()
-	case runtime.Client:
-		request, err := runtime.ConstructRequest(flag.Args(), false)
+	case runtime.Check:
+		if !store.CheckStore() {
+			os.Exit(1)
+		}
+	case runtime.Repair:
+		if !store.RepairStore() {
+			os.Exit(1)
+		}
+	case runtime.Inspect:
+		first, last, err := parseSlotRange(*slotsFlag)
 		if err != nil {
 			log.Fatal(err)
 		}
-		client.MakeRequest(request)
+		options := store.InspectOptions{
+			FirstSlot: first,
+			LastSlot:  last,
+			Pattern:   *patternFlag,
+			JSON:      *jsonFlag,
+		}
+		if !store.InspectStore(options) {
+			os.Exit(1)
+		}
+	case runtime.Client:
+		switch command {
+		case "export":
+			var path string
+			if len(args) > 1 {
+				path = args[1]
+			}
+			client.Export(path)
+			return
+		case "import":
+			if len(args) < 2 {
+				log.Fatal("need a file to import (or - for stdin)")
+			}
+			client.Import(args[1])
+			return
+		case "diff":
+			if len(args) < 3 {
+				log.Fatal("need two store files to diff")
+			}
+			differ, err := store.DiffStores(args[1], args[2])
+			if err != nil {
+				log.Print(err)
+				os.Exit(2)
+			}
+			if differ {
+				os.Exit(1)
+			}
+			return
+		case "merge":
+			if len(args) < 3 {
+				log.Fatal("need a source & target store file to merge")
+			}
+			strategy, err := store.ParseMergeStrategy(*strategyFlag)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = store.MergeStores(args[1], args[2], strategy)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "batch":
+			if len(args) < 2 {
+				log.Fatal("need a file of commands (or - for stdin)")
+			}
+			if !client.Batch(args[1], *stopOnErrorFlag) {
+				os.Exit(1)
+			}
+			return
+		case "import-csv":
+			if len(args) < 2 {
+				log.Fatal("need a file to import (or - for stdin)")
+			}
+			client.ImportCSV(
+				args[1],
+				*keyColumnFlag,
+				*valueColumnFlag,
+				*csvHeaderFlag,
+			)
+			return
+		}
+		var requests []runtime.Request
+		for _, commandArgs := range splitCommands(args) {
+			request, err := runtime.ConstructRequest(commandArgs, false)
+			if err != nil {
+				log.Fatal(err)
+			}
+			requests = append(requests, request)
+		}
+		client.MakeRequests(requests)
+	}
+}
+
+// Client commands run locally rather than sent as a request
+var localCommands = map[string]bool{
+	"export":     true,
+	"import":     true,
+	"import-csv": true,
+	"diff":       true,
+	"merge":      true,
+	"batch":      true,
+}
+
+// Parse flags given among args with fs, returning the other arguments in
+// order; fs.Parse alone stops at the first argument that isn't a flag
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" {
+			return append(positional, args[1:]...)
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			// - is the path for stdin
+			positional = append(positional, arg)
+			args = args[1:]
+			continue
+		}
+		if err := fs.Parse(args); err != nil {
+			log.Fatal(err)
+		}
+		args = fs.Args()
+	}
+	return positional
+}
+
+// Split args into separate commands on standalone ';' arguments
+func splitCommands(args []string) [][]string {
+	commands := [][]string{{}}
+	for _, arg := range args {
+		if arg == ";" {
+			commands = append(commands, []string{})
+			continue
+		}
+		last := len(commands) - 1
+		commands[last] = append(commands[last], arg)
+	}
+	return commands
+}
+
+// Parse a slot range of A-B, A-, -B or a single slot A; 0 leaves an end open
+func parseSlotRange(s string) (int64, int64, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	firstStr, lastStr, isRange := strings.Cut(s, "-")
+	if !isRange {
+		lastStr = firstStr
+	}
+	var first, last int64
+	var err error
+	if firstStr != "" {
+		if first, err = strconv.ParseInt(firstStr, 10, 64); err != nil || first < 1 {
+			return 0, 0, fmt.Errorf("invalid slot range '%s'", s)
+		}
+	}
+	if lastStr != "" {
+		if last, err = strconv.ParseInt(lastStr, 10, 64); err != nil || last < 1 {
+			return 0, 0, fmt.Errorf("invalid slot range '%s'", s)
+		}
+	}
+	if first > 0 && last > 0 && first > last {
+		return 0, 0, fmt.Errorf("slot range '%s' ends before it starts", s)
 	}
+	return first, last, nil
 }
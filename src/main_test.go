@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		strategy   string
+	}{
+		{[]string{"a.bin", "b.bin"}, []string{"a.bin", "b.bin"}, "ours"},
+		{[]string{"a.bin", "b.bin", "--strategy=theirs"}, []string{"a.bin", "b.bin"}, "theirs"},
+		{[]string{"a.bin", "--strategy", "newest", "b.bin"}, []string{"a.bin", "b.bin"}, "newest"},
+		{[]string{"-", "--strategy=theirs"}, []string{"-"}, "theirs"},
+		{[]string{"a.bin", "--", "--strategy=theirs"}, []string{"a.bin", "--strategy=theirs"}, "ours"},
+	}
+	for _, test := range tests {
+		fs := flag.NewFlagSet("getit", flag.ContinueOnError)
+		strategy := fs.String("strategy", "ours", "")
+		positional := parseInterspersed(fs, test.args)
+		if !slices.Equal(positional, test.positional) || *strategy != test.strategy {
+			t.Errorf(
+				"parseInterspersed(%v) = %v with strategy %s",
+				test.args,
+				positional,
+				*strategy,
+			)
+		}
+	}
+}
+
+func TestParseSlotRange(t *testing.T) {
+	valid := map[string][2]int64{
+		"":     {0, 0},
+		"3-9":  {3, 9},
+		"3-":   {3, 0},
+		"-9":   {0, 9},
+		"5":    {5, 5},
+		"5-5":  {5, 5},
+		"1-50": {1, 50},
+	}
+	for s, want := range valid {
+		first, last, err := parseSlotRange(s)
+		if err != nil || first != want[0] || last != want[1] {
+			t.Errorf("parseSlotRange(%q) = %d, %d, %v", s, first, last, err)
+		}
+	}
+	for _, s := range []string{"9-3", "0-3", "a-3", "3-b", "-0", "-3-"} {
+		if _, _, err := parseSlotRange(s); err == nil {
+			t.Errorf("parseSlotRange(%q) should fail", s)
+		}
+	}
+}
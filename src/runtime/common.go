@@ -1,10 +1,17 @@
 package runtime
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 )
 
+const maxFrameSize = math.MaxUint16 // limit of the 2 byte length header
+
 // Handles message boundary detection for requests/responses
 type Framer interface {
 	Encode() []byte
@@ -19,20 +26,61 @@ func Frame(f Framer) []byte {
 	return msg
 }
 
-// Read and stream frames
-func FrameChannel(b []byte) <-chan []byte {
-	out := make(chan []byte)
-	bytesLen := uint16(len(b))
-	var index uint16
-	go func() {
-		defer close(out)
-		for index < bytesLen {
-			header := binary.BigEndian.Uint16(b[index : index+2])
-			out <- b[index+2 : index+header+2]
-			index += header + 2
+// Returned when the connection closes partway through a frame
+var ErrTruncatedFrame = errors.New("connection closed partway through a frame")
+
+// Returned for a frame header outside the sizes the reader accepts
+type FrameSizeError struct {
+	Size    int
+	MaxSize int
+}
+
+func (e FrameSizeError) Error() string {
+	return fmt.Sprintf(
+		"frame of %d bytes outside accepted size of 1-%d bytes",
+		e.Size,
+		e.MaxSize,
+	)
+}
+
+// Reads whole frames from a stream, however they are split across reads or
+// coalesced into one
+type FrameReader struct {
+	r       *bufio.Reader
+	maxSize int
+}
+
+func NewFrameReader(r io.Reader) *FrameReader {
+	return NewFrameReaderSize(r, maxFrameSize)
+}
+
+// Make a frame reader that refuses frames larger than maxSize
+func NewFrameReaderSize(r io.Reader, maxSize int) *FrameReader {
+	return &FrameReader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+// Read the length header then exactly that many bytes of the next frame.
+// Returns io.EOF only if the stream ends on a frame boundary
+func (f *FrameReader) ReadFrame() ([]byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(f.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncatedFrame
 		}
-	}()
-	return out
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint16(header[:]))
+	if size == 0 || size > f.maxSize {
+		return nil, FrameSizeError{Size: size, MaxSize: f.maxSize}
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(f.r, frame); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncatedFrame
+		}
+		return nil, err
+	}
+	return frame, nil
 }
 
 // Write encoded bytes for an entry key with optional padding
@@ -41,7 +89,7 @@ func WriteKeyBytes(buf *bytes.Buffer, key string, pad bool) {
 	buf.WriteByte(byte(keyLen)) // number of bytes
 	buf.Write([]byte(key))
 	if pad {
-		paddedBytes := make([]byte, maxStringLen-keyLen)
+		paddedBytes := make([]byte, MaxStringLen-keyLen)
 		buf.Write(paddedBytes)
 	}
 }
@@ -63,7 +111,7 @@ func WriteStringBytes(buf *bytes.Buffer, s string, pad bool) {
 	buf.WriteByte(byte(len(s))) // number of bytes
 	buf.Write([]byte(s))
 	if pad {
-		paddedBytes := make([]byte, maxStringLen-dataLen)
+		paddedBytes := make([]byte, MaxStringLen-dataLen)
 		buf.Write(paddedBytes)
 	}
 }
@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func frameBytes(payloads ...string) []byte {
+	var b []byte
+	for _, p := range payloads {
+		b = append(b, byte(len(p)>>8), byte(len(p)))
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestFrameReader(t *testing.T) {
+	large := string(bytes.Repeat([]byte("x"), 5000))
+	stream := frameBytes("first", large, "third")
+	readers := map[string]io.Reader{
+		"coalesced": bytes.NewReader(stream),
+		"split":     iotest.OneByteReader(bytes.NewReader(stream)),
+	}
+	for name, r := range readers {
+		frames := NewFrameReader(r)
+		for _, want := range []string{"first", large, "third"} {
+			got, err := frames.ReadFrame()
+			if err != nil || string(got) != want {
+				t.Fatalf("%s: ReadFrame = %d bytes, %v", name, len(got), err)
+			}
+		}
+		if _, err := frames.ReadFrame(); err != io.EOF {
+			t.Errorf("%s: ReadFrame at end = %v, want EOF", name, err)
+		}
+	}
+}
+
+func TestFrameReaderErrors(t *testing.T) {
+	stream := frameBytes("whole")
+	cases := map[string]struct {
+		b       []byte
+		maxSize int
+		want    error
+	}{
+		"truncated header":  {stream[:1], maxFrameSize, ErrTruncatedFrame},
+		"truncated payload": {stream[:4], maxFrameSize, ErrTruncatedFrame},
+		"empty":             {frameBytes(""), maxFrameSize, FrameSizeError{0, maxFrameSize}},
+		"oversized":         {stream, 4, FrameSizeError{len("whole"), 4}},
+	}
+	for name, c := range cases {
+		_, err := NewFrameReaderSize(bytes.NewReader(c.b), c.maxSize).ReadFrame()
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: ReadFrame = %v, want %v", name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Version of the request & response frame layout; bumped whenever a change
+// would be misread by the other side
+const ProtocolVersion byte = 1
+
+const helloMagic = "gtit"
+const helloSize = len(helloMagic) + 1 + 4 // magic, version, features
+
+// Optional protocol features a client & server agree on in the handshake
+type Feature uint32
+
+const (
+	FeatureLargeValues Feature = 1 << iota
+	FeatureRequestIds
+	FeatureCompression
+)
+
+// Features this build can speak
+const SupportedFeatures = FeatureRequestIds
+
+// Features every connection must agree on; frames can't be read without them
+const RequiredFeatures = FeatureRequestIds
+
+func (f Feature) String() string {
+	names := []string{"large-values", "ids", "compression"}
+	var set []string
+	for i, name := range names {
+		if f&(1<<i) != 0 {
+			set = append(set, name)
+		}
+	}
+	if len(set) == 0 {
+		return "none"
+	}
+	return strings.Join(set, ",")
+}
+
+// Returned when the other side of a connection can't speak this protocol
+type HandshakeError struct {
+	errorStr string
+}
+
+func (e HandshakeError) Error() string {
+	return fmt.Sprintf("Handshake failed; %s", e.errorStr)
+}
+
+// Frame sent by the server to refuse a connection, laid out as an invalid
+// request response from before requests carried ids so that older clients
+// can report it too
+func (e HandshakeError) Encode() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(byte(InvalidRequest))
+	buf.WriteByte(byte(1)) // type of data: string
+	buf.WriteString(e.errorStr)
+	return buf.Bytes()
+}
+
+// Refusal to send a client whose hello failed with err; errors that aren't
+// about the handshake are refused without their detail
+func Refusal(err error) HandshakeError {
+	var handshakeErr HandshakeError
+	if errors.As(err, &handshakeErr) {
+		return handshakeErr
+	}
+	return HandshakeError{errorStr: "server could not agree a protocol"}
+}
+
+// First frame in each direction on a connection: the client offers its
+// version & features, the server answers with the features both support
+type Hello struct {
+	Version  byte
+	Features Feature
+}
+
+// Hello offering every feature this build supports
+func NewHello() Hello {
+	return Hello{Version: ProtocolVersion, Features: SupportedFeatures}
+}
+
+func (h Hello) String() string {
+	return fmt.Sprintf("Hello(v%d)<%s>", h.Version, h.Features)
+}
+
+func (h Hello) Encode() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(helloMagic)
+	buf.WriteByte(h.Version)
+	binary.Write(buf, binary.BigEndian, uint32(h.Features))
+	return buf.Bytes()
+}
+
+// Decode the hello a client opens a connection with
+func DecodeHello(b []byte) (Hello, error) {
+	if len(b) < helloSize || string(b[:len(helloMagic)]) != helloMagic {
+		return Hello{}, HandshakeError{
+			errorStr: fmt.Sprintf(
+				"expected a protocol %d hello; client may be out of date",
+				ProtocolVersion,
+			),
+		}
+	}
+	return Hello{
+		Version:  b[len(helloMagic)],
+		Features: Feature(binary.BigEndian.Uint32(b[len(helloMagic)+1:])),
+	}, nil
+}
+
+// Decode the server's answer to a hello, returning the refusal as an error
+func DecodeHelloReply(b []byte) (Hello, error) {
+	if len(b) > 2 && Status(b[0]) == InvalidRequest && b[1] == 1 {
+		return Hello{}, HandshakeError{errorStr: string(b[2:])}
+	}
+	if len(b) < helloSize || string(b[:len(helloMagic)]) != helloMagic {
+		return Hello{}, HandshakeError{
+			errorStr: "server did not answer the hello; it may be out of date",
+		}
+	}
+	hello, err := DecodeHello(b)
+	if err != nil {
+		return Hello{}, err
+	}
+	if hello.Version != ProtocolVersion {
+		return Hello{}, HandshakeError{
+			errorStr: fmt.Sprintf(
+				"server speaks protocol %d but client speaks %d",
+				hello.Version,
+				ProtocolVersion,
+			),
+		}
+	}
+	if missing := RequiredFeatures &^ hello.Features; missing != 0 {
+		return Hello{}, HandshakeError{
+			errorStr: fmt.Sprintf("server lacks required features %s", missing),
+		}
+	}
+	return hello, nil
+}
+
+// Agree the version & features for a connection given the client's hello;
+// the server answers with the result or refuses with the error
+func Negotiate(client Hello) (Hello, error) {
+	if client.Version != ProtocolVersion {
+		return Hello{}, HandshakeError{
+			errorStr: fmt.Sprintf(
+				"client speaks protocol %d but server speaks %d",
+				client.Version,
+				ProtocolVersion,
+			),
+		}
+	}
+	if missing := RequiredFeatures &^ client.Features; missing != 0 {
+		return Hello{}, HandshakeError{
+			errorStr: fmt.Sprintf("client lacks required features %s", missing),
+		}
+	}
+	return Hello{
+		Version:  ProtocolVersion,
+		Features: client.Features & SupportedFeatures,
+	}, nil
+}
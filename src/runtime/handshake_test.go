@@ -0,0 +1,67 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHelloRoundTrip(t *testing.T) {
+	hello := NewHello()
+	decoded, err := DecodeHello(hello.Encode())
+	if err != nil {
+		t.Fatalf("DecodeHello: %v", err)
+	}
+	if decoded != hello {
+		t.Errorf("decoded %v, want %v", decoded, hello)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	all := FeatureLargeValues | FeatureRequestIds | FeatureCompression
+	agreed, err := Negotiate(Hello{Version: ProtocolVersion, Features: all})
+	if err != nil {
+		t.Fatalf("Negotiate: %v", err)
+	}
+	if agreed.Features != SupportedFeatures {
+		t.Errorf("agreed features %s, want %s", agreed.Features, SupportedFeatures)
+	}
+	reply, err := DecodeHelloReply(agreed.Encode())
+	if err != nil || reply != agreed {
+		t.Errorf("DecodeHelloReply gave %v, %v; want %v", reply, err, agreed)
+	}
+
+	refused := []Hello{
+		{Version: ProtocolVersion + 1, Features: all},
+		{Version: ProtocolVersion, Features: FeatureCompression},
+	}
+	for _, hello := range refused {
+		_, err := Negotiate(hello)
+		var handshakeErr HandshakeError
+		if !errors.As(err, &handshakeErr) {
+			t.Fatalf("Negotiate(%v) should be refused", hello)
+		}
+		// the client reports the server's refusal as its own error
+		_, replyErr := DecodeHelloReply(handshakeErr.Encode())
+		if replyErr == nil || replyErr.Error() != err.Error() {
+			t.Errorf("refusal of %v decoded as %v, want %v", hello, replyErr, err)
+		}
+	}
+}
+
+func TestDecodeHelloErrors(t *testing.T) {
+	frames := [][]byte{
+		{},
+		[]byte("gtit"),
+		[]byte("nope\x01\x00\x00\x00\x02"),
+		{byte(Load), 0, 0, 0, 1, 1, 'a'}, // request from a client without hello
+	}
+	for _, frame := range frames {
+		if _, err := DecodeHello(frame); err == nil {
+			t.Errorf("DecodeHello(% x) should fail", frame)
+		}
+	}
+	// a reply from a server without hello
+	if _, err := DecodeHelloReply([]byte{byte(Ok), 0, 0, 0, 1}); err == nil {
+		t.Error("DecodeHelloReply should fail on a response frame")
+	}
+}
@@ -0,0 +1,38 @@
+package runtime
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*:email", "user:42:email", true},
+		{"user:*:email", "user:42:name", false},
+		{"user:*:email", "user:a/b:email", true},
+		{"a*b*c", "aXXbYYbZc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[!e]llo", "hallo", true},
+		{"h[!e]llo", "hello", false},
+		{"key[0-9]", "key7", true},
+		{"key[0-9]", "keyx", false},
+		{"[]]", "]", true},
+		{"a[", "a[", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{`a\`, `a\`, true},
+	}
+	for _, c := range cases {
+		if got := MatchPattern(c.pattern, c.s); got != c.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
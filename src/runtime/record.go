@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+const recordInt = "int"
+const recordString = "string"
+
+// A key & its typed value in the JSON Lines export format
+type record struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Encode a key & its int or string value as a JSON line
+func EncodeRecord(key string, value any) string {
+	var valueType string
+	switch value.(type) {
+	case int:
+		valueType = recordInt
+	case string:
+		valueType = recordString
+	default:
+		panic("Unreachable")
+	}
+	valueBytes, _ := json.Marshal(value)
+	b, _ := json.Marshal(record{Key: key, Type: valueType, Value: valueBytes})
+	return string(b)
+}
+
+// Decode a JSON line into a key & its int or string value, validated against
+// the same limits as requests
+func DecodeRecord(line []byte) (string, any, error) {
+	var r record
+	if err := json.Unmarshal(line, &r); err != nil {
+		return "", nil, RequestParseError{errorStr: err.Error()}
+	}
+	if r.Key == "" {
+		return "", nil, RequestParseError{errorStr: "record has no key"}
+	}
+	if err := validateKey(r.Key); err != nil {
+		return "", nil, err
+	}
+	switch r.Type {
+	case recordInt:
+		var i int64
+		if err := json.Unmarshal(r.Value, &i); err != nil {
+			return "", nil, RequestParseError{
+				errorStr: fmt.Sprintf("value of %s is not an int", r.Key),
+			}
+		}
+		if i < math.MinInt32 || i > math.MaxInt32 {
+			return "", nil, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"invalid int data (must be %d-%d)",
+					math.MinInt32,
+					math.MaxInt32,
+				),
+			}
+		}
+		return r.Key, int(i), nil
+	case recordString:
+		var s string
+		if err := json.Unmarshal(r.Value, &s); err != nil {
+			return "", nil, RequestParseError{
+				errorStr: fmt.Sprintf("value of %s is not a string", r.Key),
+			}
+		}
+		if len(s) > MaxStringLen {
+			return "", nil, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"data must be less than %d characters",
+					MaxStringLen,
+				),
+			}
+		}
+		return r.Key, s, nil
+	}
+	return "", nil, RequestParseError{
+		errorStr: fmt.Sprintf("unknown record type '%s'", r.Type),
+	}
+}
+
+// Validate a key & infer the type of its value as ConstructRequest does
+func ParseRecord(key string, value string) (any, error) {
+	if key == "" {
+		return nil, RequestParseError{errorStr: "record has no key"}
+	}
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	return parseData(value)
+}
+
+// Build a bulkset batch from alternating keys & already typed values
+func NewBulkSetRequest(pairs []any) (Request, error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return request[int]{}, RequestParseError{
+			errorStr: "bulkset needs key & value pairs",
+		}
+	}
+	return checkFrameSize(newRequest(BulkSet, "", 0, pairs, false))
+}
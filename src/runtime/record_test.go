@@ -0,0 +1,36 @@
+package runtime
+
+import "testing"
+
+func TestRecordRoundTrip(t *testing.T) {
+	values := []any{0, -42, 2147483647, "", "hello world", "123", `quote " \ tab	`}
+	for _, value := range values {
+		line := EncodeRecord("key", value)
+		key, got, err := DecodeRecord([]byte(line))
+		if err != nil {
+			t.Fatalf("DecodeRecord(%s): %v", line, err)
+		}
+		if key != "key" || got != value {
+			t.Errorf("round trip of %#v gave %q, %#v", value, key, got)
+		}
+	}
+}
+
+func TestDecodeRecordErrors(t *testing.T) {
+	lines := []string{
+		`not json`,
+		`{"type":"int","value":1}`,
+		`{"key":"k","type":"int","value":"1"}`,
+		`{"key":"k","type":"int","value":1.5}`,
+		`{"key":"k","type":"int","value":2147483648}`,
+		`{"key":"k","type":"string","value":1}`,
+		`{"key":"k","type":"string","value":"this string is far too long to store"}`,
+		`{"key":"this key is far too long to be stored","type":"int","value":1}`,
+		`{"key":"k","type":"float","value":1}`,
+	}
+	for _, line := range lines {
+		if _, _, err := DecodeRecord([]byte(line)); err == nil {
+			t.Errorf("DecodeRecord(%s) should fail", line)
+		}
+	}
+}
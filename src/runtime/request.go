@@ -5,8 +5,10 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/EnemigoPython/go-getit/src/types"
 )
@@ -37,6 +39,44 @@ const (
 	Size
 	Space
 	Exit
+	Cas
+	SetNX
+	SetXX
+	GetSet
+	Watch
+	Unwatch
+	Multi
+	Exec
+	Discard
+	MGet
+	MSet
+	ScanPrefix
+	ScanRange
+	Scan
+	CreateIndex
+	DropIndex
+	FindByValue
+	Rename
+	RenameNX
+	Append
+	StrLen
+	GetRange
+	SetRange
+	Mul
+	Div
+	Mod
+	SetMax
+	SetMin
+	And
+	Or
+	Xor
+	Incr
+	Limit
+	AddClamp
+	Stats
+	Explain
+	Export
+	BulkSet
 )
 
 type ArithmeticType int
@@ -44,8 +84,44 @@ type ArithmeticType int
 const (
 	A_Add ArithmeticType = iota
 	A_Sub
+	A_Mul
+	A_Div
+	A_Mod
+	A_Max
+	A_Min
+	A_And
+	A_Or
+	A_Xor
 )
 
+// Arithmetic applied by the action, if it is an arithmetic action
+func (a Action) ArithmeticType() (ArithmeticType, bool) {
+	switch a {
+	case Add, Incr:
+		return A_Add, true
+	case Sub:
+		return A_Sub, true
+	case Mul:
+		return A_Mul, true
+	case Div:
+		return A_Div, true
+	case Mod:
+		return A_Mod, true
+	case SetMax:
+		return A_Max, true
+	case SetMin:
+		return A_Min, true
+	case And:
+		return A_And, true
+	case Or:
+		return A_Or, true
+	case Xor:
+		return A_Xor, true
+	default:
+		return 0, false
+	}
+}
+
 func (a Action) String() string {
 	return [...]string{
 		"Store",
@@ -63,6 +139,44 @@ func (a Action) String() string {
 		"Size",
 		"Space",
 		"Exit",
+		"Cas",
+		"SetNX",
+		"SetXX",
+		"GetSet",
+		"Watch",
+		"Unwatch",
+		"Multi",
+		"Exec",
+		"Discard",
+		"MGet",
+		"MSet",
+		"ScanPrefix",
+		"ScanRange",
+		"Scan",
+		"CreateIndex",
+		"DropIndex",
+		"FindByValue",
+		"Rename",
+		"RenameNX",
+		"Append",
+		"StrLen",
+		"GetRange",
+		"SetRange",
+		"Mul",
+		"Div",
+		"Mod",
+		"SetMax",
+		"SetMin",
+		"And",
+		"Or",
+		"Xor",
+		"Incr",
+		"Limit",
+		"AddClamp",
+		"Stats",
+		"Explain",
+		"Export",
+		"BulkSet",
 	}[a]
 }
 
@@ -83,6 +197,44 @@ func (a Action) ToLower() string {
 		"size",
 		"space",
 		"exit",
+		"cas",
+		"setnx",
+		"setxx",
+		"getset",
+		"watch",
+		"unwatch",
+		"multi",
+		"exec",
+		"discard",
+		"mget",
+		"mset",
+		"scanprefix",
+		"scanrange",
+		"scan",
+		"createindex",
+		"dropindex",
+		"findbyvalue",
+		"rename",
+		"renamenx",
+		"append",
+		"strlen",
+		"getrange",
+		"setrange",
+		"mul",
+		"div",
+		"mod",
+		"setmax",
+		"setmin",
+		"and",
+		"or",
+		"xor",
+		"incr",
+		"limit",
+		"addclamp",
+		"stats",
+		"explain",
+		"export",
+		"bulkset",
 	}[a]
 }
 
@@ -118,46 +270,138 @@ func parseAction(s string) (Action, error) {
 		return Space, nil
 	case Exit.ToLower():
 		return Exit, nil
+	case Cas.ToLower():
+		return Cas, nil
+	case SetNX.ToLower():
+		return SetNX, nil
+	case SetXX.ToLower():
+		return SetXX, nil
+	case GetSet.ToLower():
+		return GetSet, nil
+	case Watch.ToLower():
+		return Watch, nil
+	case Unwatch.ToLower():
+		return Unwatch, nil
+	case Multi.ToLower():
+		return Multi, nil
+	case Exec.ToLower():
+		return Exec, nil
+	case Discard.ToLower():
+		return Discard, nil
+	case MGet.ToLower():
+		return MGet, nil
+	case MSet.ToLower():
+		return MSet, nil
+	case ScanPrefix.ToLower():
+		return ScanPrefix, nil
+	case ScanRange.ToLower():
+		return ScanRange, nil
+	case Scan.ToLower():
+		return Scan, nil
+	case CreateIndex.ToLower():
+		return CreateIndex, nil
+	case DropIndex.ToLower():
+		return DropIndex, nil
+	case FindByValue.ToLower():
+		return FindByValue, nil
+	case Rename.ToLower():
+		return Rename, nil
+	case RenameNX.ToLower():
+		return RenameNX, nil
+	case Append.ToLower():
+		return Append, nil
+	case StrLen.ToLower():
+		return StrLen, nil
+	case GetRange.ToLower():
+		return GetRange, nil
+	case SetRange.ToLower():
+		return SetRange, nil
+	case Mul.ToLower():
+		return Mul, nil
+	case Div.ToLower():
+		return Div, nil
+	case Mod.ToLower():
+		return Mod, nil
+	case SetMax.ToLower():
+		return SetMax, nil
+	case SetMin.ToLower():
+		return SetMin, nil
+	case And.ToLower():
+		return And, nil
+	case Or.ToLower():
+		return Or, nil
+	case Xor.ToLower():
+		return Xor, nil
+	case Incr.ToLower():
+		return Incr, nil
+	case Limit.ToLower():
+		return Limit, nil
+	case AddClamp.ToLower():
+		return AddClamp, nil
+	case Stats.ToLower():
+		return Stats, nil
+	case Explain.ToLower():
+		return Explain, nil
+	case Export.ToLower():
+		return Export, nil
+	case BulkSet.ToLower():
+		return BulkSet, nil
 	default:
 		return Action(0), RequestParseError{errorStr: s}
 	}
 }
 
-var requestCounter uint8
+var requestCounter atomic.Uint32
 
-func generateId() uint8 {
-	go func() {
-		requestCounter++
-	}()
-	return requestCounter
+// Unique id for a request made by this process; a client matches each
+// response to its request by the id echoed back in the response frame
+func generateId() uint32 {
+	return requestCounter.Add(1)
 }
 
-const maxStringLen = 31
+const requestIdSize = 4 // bytes of the id following the action byte
+
+// Bytes every request frame starts with: the action & the request id
+const RequestHeaderSize = 1 + requestIdSize
+
+// Most bytes in a key or string value; the store pads both to this width
+const MaxStringLen = 31
+const defaultScanCount = 10
 
 type request[T types.IntOrString] struct {
 	action   Action
 	key      string
 	data     T
-	id       uint8
+	args     []any // extra int or string operands
+	id       uint32
 	internal bool
 }
 
 type Request interface {
 	GetAction() Action
 	GetKey() string
-	GetId() uint8
+	GetId() uint32
 	GetIntData() (int, error)
 	GetStringData() (string, error)
+	GetArgs() []any
 	IsStream() bool
+	IsTransactionControl() bool
 	HasData() bool
 	ArithmeticOperation(ArithmeticType, int) (int, error)
 	Encode() []byte
 	EncodeFileBytes() []byte
+	withId(uint32) Request
 }
 
 func (r request[T]) GetAction() Action { return r.action }
 func (r request[T]) GetKey() string    { return r.key }
-func (r request[T]) GetId() uint8      { return r.id }
+func (r request[T]) GetId() uint32     { return r.id }
+func (r request[T]) GetArgs() []any    { return r.args }
+
+func (r request[T]) withId(id uint32) Request {
+	r.id = id
+	return r
+}
 
 func (r request[T]) GetIntData() (int, error) {
 	switch d := any(r.data).(type) {
@@ -181,7 +425,19 @@ func (r request[T]) GetStringData() (string, error) {
 
 func (r request[T]) IsStream() bool {
 	switch r.action {
-	case Keys, Values, Items:
+	case
+		Keys,
+		Values,
+		Items,
+		Exec,
+		MGet,
+		ScanPrefix,
+		ScanRange,
+		Scan,
+		FindByValue,
+		Stats,
+		Explain,
+		Export:
 		return true
 	default:
 		return false
@@ -201,7 +457,50 @@ func (r request[T]) HasData() bool {
 		Items,
 		Count,
 		Size,
-		Space:
+		Space,
+		Cas,
+		SetNX,
+		SetXX,
+		GetSet,
+		Watch,
+		MGet,
+		MSet,
+		ScanPrefix,
+		ScanRange,
+		Scan,
+		CreateIndex,
+		FindByValue,
+		Rename,
+		RenameNX,
+		Append,
+		StrLen,
+		GetRange,
+		SetRange,
+		Mul,
+		Div,
+		Mod,
+		SetMax,
+		SetMin,
+		And,
+		Or,
+		Xor,
+		Incr,
+		Limit,
+		AddClamp,
+		Stats,
+		Explain,
+		Export,
+		BulkSet:
+		return true
+	default:
+		return false
+	}
+}
+
+// Whether the request controls a transaction rather than operating on data
+func (r request[T]) IsTransactionControl() bool {
+	switch r.action {
+	case Watch, Unwatch, Multi, Exec, Discard:
 		return true
 	default:
 		return false
@@ -217,6 +516,26 @@ func (r request[T]) ArithmeticOperation(a ArithmeticType, i int) (int, error) {
 			return i + d, nil
 		case A_Sub:
 			return i - d, nil
+		case A_Mul:
+			return i * d, nil
+		case A_Div, A_Mod:
+			if d == 0 {
+				return 0, RequestParseError{errorStr: "division by zero"}
+			}
+			if a == A_Div {
+				return i / d, nil
+			}
+			return i % d, nil
+		case A_Max:
+			return max(i, d), nil
+		case A_Min:
+			return min(i, d), nil
+		case A_And:
+			return i & d, nil
+		case A_Or:
+			return i | d, nil
+		case A_Xor:
+			return i ^ d, nil
 		}
 	case string:
 		return 0, RequestParseError{errorStr: "string is invalid data type"}
@@ -237,17 +556,72 @@ func (r request[T]) writeDataBytes(buf *bytes.Buffer, pad bool) {
 	}
 }
 
+// Write the number of extra operands followed by each typed operand
+func (r request[T]) writeArgBytes(buf *bytes.Buffer) {
+	binary.Write(buf, binary.BigEndian, uint16(len(r.args)))
+	for _, arg := range r.args {
+		switch a := arg.(type) {
+		case int:
+			WriteIntBytes(buf, a, false)
+		case string:
+			WriteStringBytes(buf, a, false)
+		}
+	}
+}
+
 func (r request[T]) Encode() []byte {
 	buf := new(bytes.Buffer)
 	buf.WriteByte(byte(r.action))
+	binary.Write(buf, binary.BigEndian, r.id)
 	switch r.action {
-	case Store, Copy, Add, Sub:
+	case
+		Store,
+		Copy,
+		Add,
+		Sub,
+		Mul,
+		Div,
+		Mod,
+		SetMax,
+		SetMin,
+		And,
+		Or,
+		Xor,
+		Incr,
+		SetNX,
+		SetXX,
+		GetSet,
+		CreateIndex,
+		FindByValue,
+		Rename,
+		RenameNX,
+		Append:
 		r.writeKeyBytes(buf, false)
 		r.writeDataBytes(buf, false)
-	case Load, Clear, Space:
+	case Cas, GetRange, SetRange, Limit, AddClamp:
 		r.writeKeyBytes(buf, false)
+		r.writeDataBytes(buf, false)
+		r.writeArgBytes(buf)
+	case
+		Load,
+		Clear,
+		Space,
+		ScanPrefix,
+		Keys,
+		Values,
+		Items,
+		DropIndex,
+		StrLen,
+		Explain:
+		r.writeKeyBytes(buf, false)
+	case ScanRange, Scan:
+		r.writeKeyBytes(buf, false)
+		r.writeDataBytes(buf, false)
+		r.writeArgBytes(buf)
 	case Resize:
 		r.writeDataBytes(buf, false)
+	case Watch, MGet, MSet, BulkSet:
+		r.writeArgBytes(buf)
 	default:
 		// no extra data fields needed
 	}
@@ -265,7 +639,23 @@ func (r request[T]) EncodeFileBytes() []byte {
 func (r request[T]) String() string {
 	var body string
 	switch r.action {
-	case Store, Add, Sub:
+	case
+		Store,
+		Add,
+		Sub,
+		Mul,
+		Div,
+		Mod,
+		SetMax,
+		SetMin,
+		And,
+		Or,
+		Xor,
+		Incr,
+		SetNX,
+		SetXX,
+		GetSet,
+		Append:
 		switch d := any(r.data).(type) {
 		case int:
 			body = fmt.Sprintf("%s[%s:%d]", r.action, r.key, d)
@@ -274,7 +664,7 @@ func (r request[T]) String() string {
 		default:
 			panic("Unreachable")
 		}
-	case Copy:
+	case Copy, Rename, RenameNX:
 		switch d := any(r.data).(type) {
 		case int:
 			body = fmt.Sprintf("%s[%s:%d]", r.action, r.key, d)
@@ -294,14 +684,190 @@ func (r request[T]) String() string {
 		default:
 			panic("Unreachable")
 		}
-	case Load, Clear, Space:
+	case Cas:
+		body = fmt.Sprintf(
+			"%s[%s:%s->%s]",
+			r.action,
+			r.key,
+			formatValue(r.args[0]),
+			formatValue(r.data),
+		)
+	case Load, Clear, Space, ScanPrefix, DropIndex, StrLen, Explain:
 		body = fmt.Sprintf("%s[%s]", r.action, r.key)
+	case GetRange:
+		body = fmt.Sprintf("%s[%s:%s-%d]", r.action, r.key, formatValue(r.data), r.args[0])
+	case Limit:
+		body = fmt.Sprintf(
+			"%s[%s:%s/%ds]",
+			r.action,
+			r.key,
+			formatValue(r.data),
+			r.args[0],
+		)
+	case AddClamp:
+		body = fmt.Sprintf(
+			"%s[%s:%s,%d-%d]",
+			r.action,
+			r.key,
+			formatValue(r.data),
+			r.args[0],
+			r.args[1],
+		)
+	case SetRange:
+		body = fmt.Sprintf(
+			"%s[%s:%d:%s]",
+			r.action,
+			r.key,
+			r.args[0],
+			formatValue(r.data),
+		)
+	case CreateIndex:
+		body = fmt.Sprintf("%s[%s:%s]", r.action, r.key, formatValue(r.data))
+	case FindByValue:
+		body = fmt.Sprintf("%s[%s]", r.action, formatValue(r.data))
+		if r.key != "" {
+			body = fmt.Sprintf("%s[%s:%s]", r.action, r.key, formatValue(r.data))
+		}
+	case Keys, Values, Items:
+		body = r.action.String()
+		if r.key != "" {
+			body = fmt.Sprintf("%s[%s]", r.action, r.key)
+		}
+	case ScanRange:
+		body = fmt.Sprintf("%s[%s:%s]", r.action, r.key, formatValue(r.data))
+		if len(r.args) > 0 {
+			body = fmt.Sprintf(
+				"%s[%s:%s,%d]",
+				r.action,
+				r.key,
+				formatValue(r.data),
+				r.args[0],
+			)
+		}
+	case Scan:
+		body = fmt.Sprintf("%s[%s,%d]", r.action, formatValue(r.data), r.args[0])
+		if r.key != "" {
+			body = fmt.Sprintf(
+				"%s[%s,%d,%s]",
+				r.action,
+				formatValue(r.data),
+				r.args[0],
+				r.key,
+			)
+		}
+	case Watch, MGet:
+		keys := make([]string, len(r.args))
+		for i, arg := range r.args {
+			keys[i] = fmt.Sprint(arg)
+		}
+		body = fmt.Sprintf("%s[%s]", r.action, strings.Join(keys, ","))
+	case MSet, BulkSet:
+		pairs := make([]string, 0, len(r.args)/2)
+		for i := 0; i < len(r.args); i += 2 {
+			pairs = append(
+				pairs,
+				fmt.Sprintf("%s:%s", r.args[i], formatValue(r.args[i+1])),
+			)
+		}
+		body = fmt.Sprintf("%s[%s]", r.action, strings.Join(pairs, ","))
 	default:
 		body = r.action.String()
 	}
 	return fmt.Sprintf("Request(%d)<%s>", r.id, body)
 }
 
+// Format an int or string operand for logging
+func formatValue(v any) string {
+	switch d := v.(type) {
+	case int:
+		return strconv.Itoa(d)
+	case string:
+		return fmt.Sprintf("'%s'", d)
+	}
+	panic("Unreachable")
+}
+
+// Build a request with the concrete type of the data payload
+func newRequest(
+	action Action,
+	key string,
+	data any,
+	args []any,
+	internal bool,
+) Request {
+	switch d := data.(type) {
+	case string:
+		return request[string]{
+			key:      key,
+			data:     d,
+			args:     args,
+			action:   action,
+			internal: internal,
+			id:       generateId(),
+		}
+	case int:
+		return request[int]{
+			key:      key,
+			data:     d,
+			args:     args,
+			action:   action,
+			internal: internal,
+			id:       generateId(),
+		}
+	}
+	panic("Unreachable")
+}
+
+// Reject requests that are too large to fit in a single frame
+func checkFrameSize(r Request) (Request, error) {
+	if len(r.Encode()) > maxFrameSize {
+		return request[int]{}, RequestParseError{
+			errorStr: fmt.Sprintf(
+				"request exceeds maximum frame size of %d bytes",
+				maxFrameSize,
+			),
+		}
+	}
+	return r, nil
+}
+
+func validateKey(key string) error {
+	if len(key) > MaxStringLen {
+		return RequestParseError{
+			errorStr: fmt.Sprintf(
+				"key must be less than %d characters",
+				MaxStringLen,
+			),
+		}
+	}
+	return nil
+}
+
+// Parse a value argument as an int if possible, otherwise a string
+func parseData(data string) (any, error) {
+	if i, err := strconv.Atoi(data); err == nil {
+		if i < math.MinInt32 || i > math.MaxInt32 {
+			return nil, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"invalid int data (must be %d-%d)",
+					math.MinInt32,
+					math.MaxInt32,
+				),
+			}
+		}
+		return i, nil
+	}
+	if len(data) > MaxStringLen {
+		return nil, RequestParseError{
+			errorStr: fmt.Sprintf(
+				"data must be less than %d characters",
+				MaxStringLen,
+			),
+		}
+	}
+	return data, nil
+}
+
 func ConstructRequest(args []string, internal bool) (Request, error) {
 	if len(args) == 0 {
 		return request[int]{}, RequestParseError{
@@ -322,11 +888,11 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 			}
 		}
 		key = args[1]
-		if len(key) > maxStringLen {
+		if len(key) > MaxStringLen {
 			return request[int]{}, RequestParseError{
 				errorStr: fmt.Sprintf(
 					"key must be less than %d characters",
-					maxStringLen,
+					MaxStringLen,
 				),
 			}
 		}
@@ -349,11 +915,11 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 				id:       generateId(),
 			}, nil
 		}
-		if len(data) > maxStringLen {
+		if len(data) > MaxStringLen {
 			return request[int]{}, RequestParseError{
 				errorStr: fmt.Sprintf(
 					"data must be less than %d characters",
-					maxStringLen,
+					MaxStringLen,
 				),
 			}
 		}
@@ -371,20 +937,20 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 			}
 		}
 		key = args[1]
-		if len(key) > maxStringLen {
+		if len(key) > MaxStringLen {
 			return request[int]{}, RequestParseError{
 				errorStr: fmt.Sprintf(
 					"key must be less than %d characters",
-					maxStringLen,
+					MaxStringLen,
 				),
 			}
 		}
 		data = args[2]
-		if len(data) > maxStringLen {
+		if len(data) > MaxStringLen {
 			return request[int]{}, RequestParseError{
 				errorStr: fmt.Sprintf(
 					"data must be less than %d characters",
-					maxStringLen,
+					MaxStringLen,
 				),
 			}
 		}
@@ -395,6 +961,331 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 			internal: internal,
 			id:       generateId(),
 		}, nil
+	case SetNX, SetXX, GetSet:
+		if len(args) < 3 {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"need 3 args for %s",
+					a.ToLower(),
+				),
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		value, err := parseData(args[2])
+		if err != nil {
+			return request[int]{}, err
+		}
+		return newRequest(action, key, value, nil, internal), nil
+	case Cas:
+		if len(args) < 4 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need 4 args for cas",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		expected, err := parseData(args[2])
+		if err != nil {
+			return request[int]{}, err
+		}
+		value, err := parseData(args[3])
+		if err != nil {
+			return request[int]{}, err
+		}
+		return newRequest(action, key, value, []any{expected}, internal), nil
+	case Watch, MGet:
+		if len(args) < 2 {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"need at least 2 args for %s",
+					a.ToLower(),
+				),
+			}
+		}
+		keys := make([]any, 0, len(args)-1)
+		for _, key := range args[1:] {
+			if err := validateKey(key); err != nil {
+				return request[int]{}, err
+			}
+			keys = append(keys, key)
+		}
+		return checkFrameSize(newRequest(action, "", 0, keys, internal))
+	case MSet, BulkSet:
+		if action == BulkSet && !internal {
+			// batches are only sent by import & merge
+			return request[int]{}, RequestParseError{
+				errorStr: "bulkset is internal to import; use mset",
+			}
+		}
+		if len(args) < 3 || len(args)%2 == 0 {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"need key & value pairs for %s",
+					action.ToLower(),
+				),
+			}
+		}
+		pairs := make([]any, 0, len(args)-1)
+		for i := 1; i < len(args); i += 2 {
+			if err := validateKey(args[i]); err != nil {
+				return request[int]{}, err
+			}
+			value, err := parseData(args[i+1])
+			if err != nil {
+				return request[int]{}, err
+			}
+			pairs = append(pairs, args[i], value)
+		}
+		if action == BulkSet {
+			return NewBulkSetRequest(pairs)
+		}
+		return checkFrameSize(newRequest(action, "", 0, pairs, internal))
+	case Keys, Values, Items:
+		// optional glob pattern to filter keys
+		if len(args) > 1 {
+			key = args[1]
+		}
+		if len(key) > maxPatternLen {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"pattern must be less than %d characters",
+					maxPatternLen,
+				),
+			}
+		}
+		return newRequest(action, key, 0, nil, internal), nil
+	case ScanPrefix:
+		if len(args) > 1 {
+			key = args[1]
+		}
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		return newRequest(action, key, 0, nil, internal), nil
+	case ScanRange:
+		if len(args) < 3 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need at least 3 args for scanrange",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		if err := validateKey(args[2]); err != nil {
+			return request[int]{}, err
+		}
+		var limit []any
+		if len(args) > 3 {
+			i, err := strconv.Atoi(args[3])
+			if err != nil || i < 0 || i > math.MaxInt32 {
+				return request[int]{}, RequestParseError{
+					errorStr: "limit for scanrange must be a positive integer",
+				}
+			}
+			limit = []any{i}
+		}
+		return newRequest(action, key, args[2], limit, internal), nil
+	case Scan:
+		if len(args) < 2 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need at least 2 args for scan",
+			}
+		}
+		cursor, err := strconv.Atoi(args[1])
+		if err != nil || cursor < 0 || cursor > math.MaxInt32 {
+			return request[int]{}, RequestParseError{
+				errorStr: "cursor for scan must be a positive integer",
+			}
+		}
+		count := defaultScanCount
+		options := args[2:]
+		for len(options) > 0 {
+			if len(options) < 2 {
+				return request[int]{}, RequestParseError{
+					errorStr: fmt.Sprintf("missing value for %s", options[0]),
+				}
+			}
+			switch strings.ToLower(options[0]) {
+			case "count":
+				count, err = strconv.Atoi(options[1])
+				if err != nil || count < 1 || count > math.MaxInt32 {
+					return request[int]{}, RequestParseError{
+						errorStr: "count for scan must be a positive integer",
+					}
+				}
+			case "match":
+				key = options[1]
+				if len(key) > maxPatternLen {
+					return request[int]{}, RequestParseError{
+						errorStr: fmt.Sprintf(
+							"pattern must be less than %d characters",
+							maxPatternLen,
+						),
+					}
+				}
+			default:
+				return request[int]{}, RequestParseError{
+					errorStr: fmt.Sprintf("invalid scan option: %s", options[0]),
+				}
+			}
+			options = options[2:]
+		}
+		return newRequest(action, key, cursor, []any{count}, internal), nil
+	case Append:
+		if len(args) < 3 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need 3 args for append",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		// appended as text even if the suffix looks like a number
+		data = args[2]
+		if len(data) > MaxStringLen {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"data must be less than %d characters",
+					MaxStringLen,
+				),
+			}
+		}
+		return newRequest(action, key, data, nil, internal), nil
+	case StrLen, Explain:
+		if len(args) < 2 {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf("need 2 args for %s", action.ToLower()),
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		return newRequest(action, key, 0, nil, internal), nil
+	case GetRange:
+		if len(args) < 4 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need 4 args for getrange",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		start, err := strconv.Atoi(args[2])
+		if err != nil || start < math.MinInt32 || start > math.MaxInt32 {
+			return request[int]{}, RequestParseError{
+				errorStr: "start for getrange must be an integer",
+			}
+		}
+		end, err := strconv.Atoi(args[3])
+		if err != nil || end < math.MinInt32 || end > math.MaxInt32 {
+			return request[int]{}, RequestParseError{
+				errorStr: "end for getrange must be an integer",
+			}
+		}
+		return newRequest(action, key, start, []any{end}, internal), nil
+	case SetRange:
+		if len(args) < 4 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need 4 args for setrange",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		offset, err := strconv.Atoi(args[2])
+		if err != nil || offset < 0 || offset > MaxStringLen {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"offset for setrange must be 0-%d",
+					MaxStringLen,
+				),
+			}
+		}
+		data = args[3]
+		if len(data) > MaxStringLen {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"data must be less than %d characters",
+					MaxStringLen,
+				),
+			}
+		}
+		return newRequest(action, key, data, []any{offset}, internal), nil
+	case Rename, RenameNX:
+		if len(args) < 3 {
+			return request[int]{}, RequestParseError{
+				errorStr: fmt.Sprintf(
+					"need 3 args for %s",
+					a.ToLower(),
+				),
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		data = args[2]
+		if err := validateKey(data); err != nil {
+			return request[int]{}, err
+		}
+		return newRequest(action, key, data, nil, internal), nil
+	case CreateIndex:
+		if len(args) < 2 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need at least 2 args for createindex",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		// optional prefix to only index matching keys
+		if len(args) > 2 {
+			data = args[2]
+		}
+		if err := validateKey(data); err != nil {
+			return request[int]{}, err
+		}
+		return newRequest(action, key, data, nil, internal), nil
+	case DropIndex:
+		if len(args) < 2 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need 2 args for dropindex",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		return newRequest(action, key, 0, nil, internal), nil
+	case FindByValue:
+		if len(args) < 2 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need at least 2 args for findbyvalue",
+			}
+		}
+		value, err := parseData(args[1])
+		if err != nil {
+			return request[int]{}, err
+		}
+		// optional index name to search, otherwise all indexes
+		if len(args) > 2 {
+			key = args[2]
+		}
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		return newRequest(action, key, value, nil, internal), nil
 	case Resize:
 		if len(args) < 2 {
 			return request[int]{}, RequestParseError{
@@ -422,7 +1313,88 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 		return request[int]{}, RequestParseError{
 			errorStr: "data for resize must be an integer",
 		}
-	case Add, Sub:
+	case Incr:
+		if len(args) < 2 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need at least 2 args for incr",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		// optional amount to increment by
+		delta := 1
+		if len(args) > 2 {
+			i, err := strconv.Atoi(args[2])
+			if err != nil || i < math.MinInt32 || i > math.MaxInt32 {
+				return request[int]{}, RequestParseError{
+					errorStr: "data for incr must be an integer",
+				}
+			}
+			delta = i
+		}
+		return newRequest(action, key, delta, nil, internal), nil
+	case Limit:
+		if len(args) < 4 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need 4 args for limit",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		maxCalls, err := strconv.Atoi(args[2])
+		if err != nil || maxCalls < 1 || maxCalls > math.MaxInt32 {
+			return request[int]{}, RequestParseError{
+				errorStr: "max for limit must be a positive integer",
+			}
+		}
+		window, err := strconv.Atoi(args[3])
+		if err != nil || window < 1 || window > math.MaxInt32 {
+			return request[int]{}, RequestParseError{
+				errorStr: "window for limit must be a positive number of seconds",
+			}
+		}
+		return newRequest(action, key, maxCalls, []any{window}, internal), nil
+	case AddClamp:
+		if len(args) < 5 {
+			return request[int]{}, RequestParseError{
+				errorStr: "need 5 args for addclamp",
+			}
+		}
+		key = args[1]
+		if err := validateKey(key); err != nil {
+			return request[int]{}, err
+		}
+		bounds := make([]int, 0, 3)
+		for _, arg := range args[2:5] {
+			i, err := strconv.Atoi(arg)
+			if err != nil || i < math.MinInt32 || i > math.MaxInt32 {
+				return request[int]{}, RequestParseError{
+					errorStr: fmt.Sprintf(
+						"data for addclamp must be integers (%d-%d)",
+						math.MinInt32,
+						math.MaxInt32,
+					),
+				}
+			}
+			bounds = append(bounds, i)
+		}
+		if bounds[1] > bounds[2] {
+			return request[int]{}, RequestParseError{
+				errorStr: "min for addclamp must not be greater than max",
+			}
+		}
+		return newRequest(
+			action,
+			key,
+			bounds[0],
+			[]any{bounds[1], bounds[2]},
+			internal,
+		), nil
+	case Add, Sub, Mul, Div, Mod, SetMax, SetMin, And, Or, Xor:
 		if len(args) < 3 {
 			return request[int]{}, RequestParseError{
 				errorStr: fmt.Sprintf(
@@ -432,11 +1404,11 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 			}
 		}
 		key = args[1]
-		if len(key) > maxStringLen {
+		if len(key) > MaxStringLen {
 			return request[int]{}, RequestParseError{
 				errorStr: fmt.Sprintf(
 					"key must be less than %d characters",
-					maxStringLen,
+					MaxStringLen,
 				),
 			}
 		}
@@ -472,11 +1444,11 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 			}
 		}
 		key = args[1]
-		if len(key) > maxStringLen {
+		if len(key) > MaxStringLen {
 			return request[int]{}, RequestParseError{
 				errorStr: fmt.Sprintf(
 					"Key must be less than %d characters",
-					maxStringLen,
+					MaxStringLen,
 				),
 			}
 		}
@@ -488,18 +1460,22 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 		}, nil
 	case Clear:
 		if len(args) < 2 {
-			return request[int]{action: ClearAll, internal: internal}, nil
+			return request[int]{
+				action:   ClearAll,
+				internal: internal,
+				id:       generateId(),
+			}, nil
 		}
 		key = args[1]
-		if len(key) > maxStringLen {
+		if len(key) > MaxStringLen {
 			return request[int]{}, RequestParseError{
 				errorStr: fmt.Sprintf(
 					"Key must be less than %d characters",
-					maxStringLen,
+					MaxStringLen,
 				),
 			}
 		}
-		return request[int]{key: key, action: action}, nil
+		return request[int]{key: key, action: action, id: generateId()}, nil
 	case Space:
 		if len(args) < 2 {
 			return request[int]{
@@ -539,56 +1515,243 @@ func ConstructRequest(args []string, internal bool) (Request, error) {
 	}
 }
 
-func decodeKey(b []byte) string {
-	keyLen := int(b[1])
-	return string(b[2 : 2+keyLen])
+// Reads the fields of a request body in order, refusing to read past its end
+type requestDecoder struct {
+	b []byte
+}
+
+var errShortRequest = RequestParseError{
+	errorStr: "request frame ends partway through a field",
+}
+
+// Take the next n bytes of the body
+func (d *requestDecoder) next(n int) ([]byte, error) {
+	if n > len(d.b) {
+		return nil, errShortRequest
+	}
+	field := d.b[:n]
+	d.b = d.b[n:]
+	return field, nil
+}
+
+// Read a length prefixed string of at most maxLen bytes
+func (d *requestDecoder) string(maxLen int) (string, error) {
+	n, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	if int(n[0]) > maxLen {
+		return "", RequestParseError{
+			errorStr: fmt.Sprintf(
+				"string of %d bytes exceeds %d characters",
+				n[0],
+				maxLen,
+			),
+		}
+	}
+	s, err := d.next(int(n[0]))
+	return string(s), err
 }
 
-func decodeStringData(b []byte) string {
-	dataLen := int(b[0])
-	return string(b[1 : 1+dataLen])
+// Read a typed int or string value
+func (d *requestDecoder) data() (any, error) {
+	dataType, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	switch dataType[0] {
+	case 0:
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return int(int32(binary.BigEndian.Uint32(b))), nil
+	case 1:
+		return d.string(MaxStringLen)
+	default:
+		return nil, RequestParseError{
+			errorStr: fmt.Sprintf("unknown data type %d", dataType[0]),
+		}
+	}
+}
+
+// Read the number of extra operands followed by each typed operand
+func (d *requestDecoder) args() ([]any, error) {
+	b, err := d.next(2)
+	if err != nil {
+		return nil, err
+	}
+	argCount := int(binary.BigEndian.Uint16(b))
+	// every operand takes at least 2 bytes; don't allocate for a count the
+	// frame can't hold
+	if argCount > len(d.b)/2 {
+		return nil, errShortRequest
+	}
+	args := make([]any, 0, argCount)
+	for range argCount {
+		arg, err := d.data()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
 }
 
-func DecodeRequest(b []byte) Request {
+// Decode a request frame, keeping the id the client assigned it. A frame
+// that can't be decoded returns an error with a request holding only its
+// action & id, so that it can still be answered
+func DecodeRequest(b []byte) (Request, error) {
+	if len(b) < RequestHeaderSize {
+		return request[int]{}, RequestParseError{
+			errorStr: fmt.Sprintf("request frame of %d bytes", len(b)),
+		}
+	}
 	action := Action(b[0])
+	id := binary.BigEndian.Uint32(b[1:RequestHeaderSize])
+	d := requestDecoder{b: b[RequestHeaderSize:]}
+	r, err := d.decodeBody(action)
+	if err != nil {
+		return request[int]{action: action, id: id}, err
+	}
+	return r.withId(id), nil
+}
+
+// Decode the fields of a request frame following its action & id
+func (d *requestDecoder) decodeBody(action Action) (Request, error) {
+	// keys filtered by a glob pattern carry the pattern in the key field
+	maxKeyLen := MaxStringLen
 	switch action {
-	case Store, Copy, Add, Sub:
-		key := decodeKey(b)
-		offset := len(key) + 2
-		if b[offset] == 0 {
-			data := int32(binary.BigEndian.Uint32(b[offset+1:]))
-			return request[int]{
-				action: action,
-				key:    key,
-				data:   int(data),
-				id:     generateId(),
-			}
+	case Keys, Values, Items, Scan:
+		maxKeyLen = maxPatternLen
+	}
+	var key string
+	var data any = 0
+	var args []any
+	var err error
+	switch action {
+	case
+		Store,
+		Copy,
+		Add,
+		Sub,
+		Mul,
+		Div,
+		Mod,
+		SetMax,
+		SetMin,
+		And,
+		Or,
+		Xor,
+		Incr,
+		SetNX,
+		SetXX,
+		GetSet,
+		CreateIndex,
+		FindByValue,
+		Rename,
+		RenameNX,
+		Append:
+		if key, err = d.string(maxKeyLen); err != nil {
+			return nil, err
 		}
-		data := decodeStringData(b[offset+1:])
-		return request[string]{
-			action: action,
-			key:    key,
-			data:   data,
-			id:     generateId(),
+		data, err = d.data()
+	case Cas, GetRange, SetRange, Limit, AddClamp, ScanRange, Scan:
+		if key, err = d.string(maxKeyLen); err != nil {
+			return nil, err
 		}
-	case Load, Clear, Space:
-		key := decodeKey(b)
-		return request[int]{
-			action: action,
-			key:    key,
-			id:     generateId(),
+		if data, err = d.data(); err != nil {
+			return nil, err
 		}
+		args, err = d.args()
+	case Watch, MGet, MSet, BulkSet:
+		args, err = d.args()
+	case
+		Load,
+		Clear,
+		Space,
+		ScanPrefix,
+		Keys,
+		Values,
+		Items,
+		DropIndex,
+		StrLen,
+		Explain:
+		key, err = d.string(maxKeyLen)
 	case Resize:
-		data := int32(binary.BigEndian.Uint32(b[2:]))
-		return request[int]{
-			action: action,
-			data:   int(data),
-			id:     generateId(),
+		if data, err = d.data(); err != nil {
+			return nil, err
+		}
+		if _, ok := data.(int); !ok {
+			err = RequestParseError{errorStr: "resize needs an int table size"}
 		}
 	default:
-		return request[int]{
-			action: action,
-			id:     generateId(),
+		// a newer client may send actions this build doesn't know
+		if action > BulkSet {
+			return nil, RequestParseError{
+				errorStr: fmt.Sprintf("unknown action %d", action),
+			}
 		}
+		// no extra data fields needed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !validOperands(action, data, args) {
+		return nil, RequestParseError{
+			errorStr: fmt.Sprintf("invalid operands for %s", action.ToLower()),
+		}
+	}
+	return newRequest(action, key, data, args, false), nil
+}
+
+// Whether a decoded request has the operands the store reads for its
+// action, with the types & ranges ConstructRequest would give them
+func validOperands(action Action, data any, args []any) bool {
+	isInt := func(v any, least int) bool {
+		i, ok := v.(int)
+		return ok && i >= least
+	}
+	isString := func(v any) bool {
+		_, ok := v.(string)
+		return ok
+	}
+	switch action {
+	case Cas:
+		return len(args) == 1
+	case GetRange:
+		return isInt(data, math.MinInt32) &&
+			len(args) == 1 && isInt(args[0], math.MinInt32)
+	case SetRange:
+		return isString(data) &&
+			len(args) == 1 && isInt(args[0], 0) && args[0].(int) <= MaxStringLen
+	case Limit:
+		return isInt(data, 1) && len(args) == 1 && isInt(args[0], 1)
+	case AddClamp:
+		return isInt(data, math.MinInt32) && len(args) == 2 &&
+			isInt(args[0], math.MinInt32) && isInt(args[1], args[0].(int))
+	case ScanRange:
+		return isString(data) &&
+			(len(args) == 0 || len(args) == 1 && isInt(args[0], 0))
+	case Scan:
+		return isInt(data, 0) && len(args) == 1 && isInt(args[0], 1)
+	case Watch, MGet:
+		return len(args) > 0 && !slices.ContainsFunc(args, func(arg any) bool {
+			return !isString(arg)
+		})
+	case MSet, BulkSet:
+		if len(args) == 0 || len(args)%2 != 0 {
+			return false
+		}
+		for i := 0; i < len(args); i += 2 {
+			if !isString(args[i]) {
+				return false
+			}
+		}
+		return true
+	case Rename, RenameNX, Append, CreateIndex:
+		return isString(data)
+	default:
+		return true
 	}
 }
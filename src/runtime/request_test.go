@@ -0,0 +1,145 @@
+package runtime
+
+import "testing"
+
+func TestRequestIdRoundTrip(t *testing.T) {
+	commands := [][]string{
+		{"store", "k", "5"},
+		{"store", "k", "five"},
+		{"load", "k"},
+		{"clear"},
+		{"clear", "k"},
+		{"cas", "k", "1", "2"},
+		{"mset", "a", "1", "b", "two"},
+		{"resize", "64"},
+		{"getrange", "k", "-3", "-1"},
+		{"setrange", "k", "2", "xy"},
+		{"limit", "k", "5", "60"},
+		{"addclamp", "k", "1", "0", "10"},
+		{"scanrange", "a", "m", "5"},
+		{"scanrange", "a", "m"},
+		{"scan", "0", "count", "5", "match", "k*"},
+		{"watch", "a", "b"},
+		{"createindex", "idx"},
+		{"createindex", "idx", "user:"},
+		{"rename", "a", "b"},
+		{"append", "k", "12"},
+		{"incr", "k"},
+		{"exit"},
+	}
+	seen := make(map[uint32]bool)
+	for _, command := range commands {
+		r, err := ConstructRequest(command, false)
+		if err != nil {
+			t.Fatalf("ConstructRequest(%v): %v", command, err)
+		}
+		if r.GetId() == 0 || seen[r.GetId()] {
+			t.Errorf("%v has id %d; ids must be unique & non-zero", command, r.GetId())
+		}
+		seen[r.GetId()] = true
+		decoded, err := DecodeRequest(r.Encode())
+		if err != nil {
+			t.Fatalf("DecodeRequest(%v): %v", command, err)
+		}
+		if decoded.GetId() != r.GetId() {
+			t.Errorf("%v decoded with id %d, want %d", command, decoded.GetId(), r.GetId())
+		}
+		if decoded.GetAction() != r.GetAction() || decoded.GetKey() != r.GetKey() {
+			t.Errorf("%v decoded as %v", command, decoded)
+		}
+	}
+}
+
+func TestDecodeMalformedRequest(t *testing.T) {
+	commands := [][]string{
+		{"store", "k", "five"},
+		{"load", "k"},
+		{"cas", "k", "1", "two"},
+		{"mget", "a", "b"},
+		{"mset", "a", "1", "b", "two"},
+		{"resize", "64"},
+		{"scan", "0", "match", "k*"},
+	}
+	for _, command := range commands {
+		r, err := ConstructRequest(command, false)
+		if err != nil {
+			t.Fatalf("ConstructRequest(%v): %v", command, err)
+		}
+		b := r.Encode()
+		for end := RequestHeaderSize; end < len(b); end++ {
+			decoded, err := DecodeRequest(b[:end])
+			if err == nil {
+				t.Errorf("%v cut to %d bytes decoded as %v", command, end, decoded)
+			} else if decoded.GetId() != r.GetId() {
+				t.Errorf("%v cut to %d bytes lost its id", command, end)
+			}
+		}
+	}
+
+	frames := map[string][]byte{
+		"short header":      {byte(Load), 0, 0},
+		"missing key bytes": {byte(Store), 0, 0, 0, 1, 200},
+		"long key": append(
+			[]byte{byte(Load), 0, 0, 0, 1, MaxStringLen + 1},
+			make([]byte, MaxStringLen+1)...,
+		),
+		"unknown data type": {byte(Store), 0, 0, 0, 1, 1, 'k', 7},
+		"arg count":         {byte(MGet), 0, 0, 0, 1, 0xff, 0xff, 1, 1, 'k'},
+		"string resize":     {byte(Resize), 0, 0, 0, 1, 1, 0},
+		"limit without window": {
+			byte(Limit), 0, 0, 0, 1, 1, 'k', 0, 0, 0, 0, 5, 0, 0,
+		},
+		"odd mset": {byte(MSet), 0, 0, 0, 1, 0, 1, 1, 1, 'k'},
+	}
+	for name, frame := range frames {
+		if decoded, err := DecodeRequest(frame); err == nil {
+			t.Errorf("%s decoded as %v", name, decoded)
+		}
+	}
+}
+
+func TestResponseIdRoundTrip(t *testing.T) {
+	r, _ := ConstructRequest([]string{"load", "k"}, false)
+	responses := []Response{
+		ConstructResponse(r, Ok, 7),
+		ConstructResponse(r, Ok, "seven"),
+		ConstructResponse(r, NotFound, 0),
+		ConstructResponse(r, InvalidRequest, "bad"),
+		ConstructResponse(r, Failed, "bad"),
+		ConstructResponse(r, Ok, 7).WithId(r.GetId() + 1),
+	}
+	for _, response := range responses {
+		decoded := DecodeResponse(response.Encode())
+		if decoded.GetId() != response.GetId() {
+			t.Errorf("%v decoded with id %d", response, decoded.GetId())
+		}
+		if decoded.GetStatus() != response.GetStatus() {
+			t.Errorf("%v decoded with status %s", response, decoded.GetStatus())
+		}
+	}
+}
+
+func TestConditionFailedPayload(t *testing.T) {
+	// a denied limit call must read differently from a failed cas
+	limit, _ := ConstructRequest([]string{"limit", "k", "1", "60"}, false)
+	cas, _ := ConstructRequest([]string{"cas", "k", "1", "2"}, false)
+	tests := map[string]Response{
+		"denied": ConstructResponse(limit, ConditionFailed, "denied"),
+		"0":      ConstructResponse(cas, ConditionFailed, 0),
+	}
+	for want, response := range tests {
+		if got := DecodeResponse(response.Encode()).DataPayload(); got != want {
+			t.Errorf("%v decoded with payload %q", response, got)
+		}
+	}
+}
+
+func TestBulkSetIsInternal(t *testing.T) {
+	command := []string{"bulkset", "a", "1"}
+	if _, err := ConstructRequest(command, false); err == nil {
+		t.Error("bulkset should not be available to the client")
+	}
+	if _, err := ConstructRequest(command, true); err != nil {
+		t.Fatalf("internal bulkset: %v", err)
+	}
+}
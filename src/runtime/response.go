@@ -18,6 +18,10 @@ const (
 	StreamDone
 	InvalidRequest
 	ServerError
+	ConditionFailed
+	Queued
+	Aborted
+	Failed // a command queued in a transaction failed; the rest still ran
 )
 
 func (s Status) String() string {
@@ -27,6 +31,10 @@ func (s Status) String() string {
 		"StreamDone",
 		"InvalidRequest",
 		"ServerError",
+		"ConditionFailed",
+		"Queued",
+		"Aborted",
+		"Failed",
 	}[s]
 }
 
@@ -37,33 +45,71 @@ func (s Status) ToLower() string {
 		"streamdone",
 		"invalidrequest",
 		"servererror",
+		"conditionfailed",
+		"queued",
+		"aborted",
+		"failed",
 	}[s]
 }
 
+// Whether responses with the status carry their data in the frame
+func (s Status) hasPayload() bool {
+	switch s {
+	case Ok, InvalidRequest, ConditionFailed, Failed:
+		return true
+	default:
+		return false
+	}
+}
+
+const responseHeaderSize = 1 + requestIdSize // status & request id
+
 type response[T types.IntOrString] struct {
 	status   Status
 	data     T
 	hasData  bool
-	id       uint8
+	id       uint32
 	isStream bool
 }
 
 type Response interface {
 	GetStatus() Status
+	GetId() uint32
+	WithId(uint32) Response
 	StreamDone() bool
+	EndsStream() bool
 	Encode() []byte
 	DataPayload() string
+	ErrorMessage() string
 }
 
 func (r response[T]) GetStatus() Status { return r.status }
+func (r response[T]) GetId() uint32     { return r.id }
+
+// Copy of the response answering the request with another id
+func (r response[T]) WithId(id uint32) Response {
+	r.id = id
+	return r
+}
 
 func (r response[T]) StreamDone() bool {
 	return r.isStream && r.status == Ok
 }
 
+// Whether the response is the last one sent for a stream request
+func (r response[T]) EndsStream() bool {
+	switch r.status {
+	case StreamDone, InvalidRequest, ServerError, Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
 func (r response[T]) String() string {
 	var body string
-	if r.hasData || r.status == InvalidRequest || r.status == ServerError {
+	isError := r.status == InvalidRequest || r.status == ServerError || r.status == Failed
+	if r.hasData || isError {
 		switch d := any(r.data).(type) {
 		case int:
 			body = fmt.Sprintf("%s,%d", r.status, d)
@@ -79,8 +125,8 @@ func (r response[T]) String() string {
 func (r response[T]) Encode() []byte {
 	buf := new(bytes.Buffer)
 	buf.WriteByte(byte(r.status))
-	statusWithPayload := r.status == Ok || r.status == InvalidRequest
-	if !statusWithPayload || !r.hasData {
+	binary.Write(buf, binary.BigEndian, r.id)
+	if !r.status.hasPayload() || !r.hasData {
 		return buf.Bytes()
 	}
 	switch d := any(r.data).(type) {
@@ -98,6 +144,10 @@ func (r response[T]) DataPayload() string {
 	switch r.status {
 	case NotFound:
 		return "" // impossible value
+	case Queued:
+		return "queued"
+	case Aborted:
+		return "aborted"
 	case InvalidRequest:
 		log.Fatal(r.data)
 	case ServerError:
@@ -112,8 +162,19 @@ func (r response[T]) DataPayload() string {
 	panic("Unreachable")
 }
 
+// Describe why a request failed; empty if the response is not an error
+func (r response[T]) ErrorMessage() string {
+	switch r.status {
+	case InvalidRequest, Failed:
+		return fmt.Sprint(r.data)
+	case ServerError:
+		return "Server error"
+	}
+	return ""
+}
+
 func ConstructResponse[T types.IntOrString](request Request, status Status, data T) Response {
-	hasData := request.HasData() || status == InvalidRequest
+	hasData := request.HasData() || status == InvalidRequest || status == Failed
 	isStream := request.IsStream()
 	switch v := any(data).(type) {
 	case int:
@@ -138,22 +199,25 @@ func ConstructResponse[T types.IntOrString](request Request, status Status, data
 
 func DecodeResponse(b []byte) Response {
 	status := Status(b[0])
-	statusWithPayload := status == Ok || status == InvalidRequest
-	if !statusWithPayload || len(b) < 2 {
-		return response[int]{status: status, hasData: false}
+	id := binary.BigEndian.Uint32(b[1:responseHeaderSize])
+	if !status.hasPayload() || len(b) <= responseHeaderSize {
+		return response[int]{status: status, id: id, hasData: false}
 	}
-	if b[1] == 0 {
-		data := int32(binary.BigEndian.Uint32(b[2:]))
+	b = b[responseHeaderSize:]
+	if b[0] == 0 {
+		data := int32(binary.BigEndian.Uint32(b[1:]))
 		return response[int]{
 			status:  status,
 			data:    int(data),
+			id:      id,
 			hasData: true,
 		}
 	} else {
-		data := string(b[2:])
+		data := string(b[1:])
 		return response[string]{
 			status:  status,
 			data:    data,
+			id:      id,
 			hasData: true,
 		}
 	}
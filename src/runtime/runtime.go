@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type RunTime int
@@ -12,6 +13,9 @@ type RunTime int
 const (
 	Server RunTime = iota
 	Client
+	Check
+	Repair
+	Inspect
 )
 
 type RunTimeParseError struct {
@@ -23,11 +27,11 @@ func (e RunTimeParseError) Error() string {
 }
 
 func (r RunTime) String() string {
-	return [...]string{"Server", "Client"}[r]
+	return [...]string{"Server", "Client", "Check", "Repair", "Inspect"}[r]
 }
 
 func (r RunTime) ToLower() string {
-	return [...]string{"server", "client"}[r]
+	return [...]string{"server", "client", "check", "repair", "inspect"}[r]
 }
 
 func parseRunTime(s string) (RunTime, error) {
@@ -38,6 +42,12 @@ func parseRunTime(s string) (RunTime, error) {
 		return Server, nil
 	case Client.ToLower():
 		return Client, nil
+	case Check.ToLower():
+		return Check, nil
+	case Repair.ToLower():
+		return Repair, nil
+	case Inspect.ToLower():
+		return Inspect, nil
 	default:
 		return RunTime(0), RunTimeParseError{runTimeStr: s}
 	}
@@ -52,6 +62,11 @@ type _Config struct {
 	StorePath string
 	TempPath  string
 	LogPath   string
+	IndexPath string
+
+	QuarantinePath string
+	BackupPath     string
+	IdleTimeout    time.Duration
 }
 
 var Config _Config
@@ -70,6 +85,24 @@ func getTempPath(absDir string, storeName string) string {
 	return tempPath
 }
 
+func getIndexPath(absDir string, storeName string) string {
+	indexPath := filepath.Join(absDir, fmt.Sprintf("%s.indexes.json", storeName))
+	return indexPath
+}
+
+func getQuarantinePath(absDir string, storeName string) string {
+	quarantinePath := filepath.Join(
+		absDir,
+		fmt.Sprintf("%s.quarantine.bin", storeName),
+	)
+	return quarantinePath
+}
+
+func getBackupPath(absDir string, storeName string) string {
+	backupPath := filepath.Join(absDir, fmt.Sprintf("%s.bak.bin", storeName))
+	return backupPath
+}
+
 func getLogPath(absDir string, storeName string, debug bool) string {
 	var logName string
 	if debug {
@@ -81,12 +114,25 @@ func getLogPath(absDir string, storeName string, debug bool) string {
 	return logPath
 }
 
+// Point the store paths at a store file other than the configured store
+func UseStoreFile(path string) {
+	absDir := filepath.Dir(path)
+	storeName := strings.TrimSuffix(filepath.Base(path), ".bin")
+	Config.StoreName = storeName
+	Config.StorePath = path
+	Config.TempPath = getTempPath(absDir, storeName)
+	Config.IndexPath = getIndexPath(absDir, storeName)
+	Config.QuarantinePath = getQuarantinePath(absDir, storeName)
+	Config.BackupPath = getBackupPath(absDir, storeName)
+}
+
 func ParseConfig(
 	runTimeStr string,
 	port int,
 	storeName string,
 	debug bool,
 	noLog bool,
+	idleTimeout time.Duration,
 ) (_Config, error) {
 	runTime, err := parseRunTime(runTimeStr)
 	if err != nil {
@@ -106,6 +152,11 @@ func ParseConfig(
 		StorePath: getStorePath(absDir, storeName),
 		TempPath:  getTempPath(absDir, storeName),
 		LogPath:   getLogPath(absDir, storeName, debug),
+		IndexPath: getIndexPath(absDir, storeName),
+
+		QuarantinePath: getQuarantinePath(absDir, storeName),
+		BackupPath:     getBackupPath(absDir, storeName),
+		IdleTimeout:    idleTimeout,
 	}
 	return Config, nil
 }
@@ -1,71 +1,142 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/EnemigoPython/go-getit/src/runtime"
 	"github.com/EnemigoPython/go-getit/src/store"
 )
 
-func handleConnection(ln net.Listener, c net.Conn) {
-	defer c.Close()
-	buf := make([]byte, 1024)
-	n, _ := c.Read(buf)
-	rawBytes := buf[:n]
+// Log, frame & write a response to the socket
+func writeResponse(c net.Conn, response runtime.Response) {
+	log.Println(response)
+	responseBytes := runtime.Frame(response)
 	if runtime.Config.Debug {
-		log.Printf("Raw bytes: % x\n", rawBytes)
+		log.Printf("Response bytes: % x\n", responseBytes)
 	}
-	for frame := range runtime.FrameChannel(rawBytes) {
-		request := runtime.DecodeRequest(frame)
-		log.Println(request)
-
-		// stream requests need to handle multiple responses
-		if request.IsStream() {
-			var endStream runtime.Response
-			for response := range store.ProcessStreamRequest(request) {
-				// on error or stream end, write other responses first
-				if response.GetStatus() != runtime.Ok {
-					endStream = response
-					continue
-				}
-				log.Println(response)
-				responseBytes := runtime.Frame(response)
-				if runtime.Config.Debug {
-					log.Printf("Response bytes: % x\n", responseBytes)
-				}
-
-				// write to socket
-				c.Write(responseBytes)
-			}
+	c.Write(responseBytes)
+}
+
+// Process one request from the connection; returns true if the server
+// should shut down
+func handleRequest(c net.Conn, tx *transaction, request runtime.Request) bool {
+	log.Println(request)
 
-			// now log & send captured end stream
-			log.Println(endStream)
-			responseBytes := runtime.Frame(endStream)
-			if runtime.Config.Debug {
-				log.Printf("Response bytes: % x\n", responseBytes)
+	// watch state & queued requests live for the connection
+	if request.IsTransactionControl() || tx.active {
+		for _, response := range tx.handle(request) {
+			writeResponse(c, response)
+		}
+		return false
+	}
+
+	// stream requests need to handle multiple responses
+	if request.IsStream() {
+		var endStream runtime.Response
+		for response := range store.ProcessStreamRequest(request) {
+			// on error or stream end, write other responses first
+			if response.EndsStream() {
+				endStream = response
+				continue
 			}
-			c.Write(responseBytes)
-			return
+			writeResponse(c, response)
 		}
 
-		// non-streamed response
-		response := store.ProcessRequest(request)
-		log.Println(response)
-		responseBytes := runtime.Frame(response)
-		if runtime.Config.Debug {
-			log.Printf("Response bytes: % x\n", responseBytes)
+		// now send captured end stream
+		writeResponse(c, endStream)
+		return false
+	}
+
+	// non-streamed response
+	response := store.ProcessRequest(request)
+	writeResponse(c, response)
+
+	// exit if command was to shut down
+	return request.GetAction() == runtime.Exit
+}
+
+// Read the next frame from the connection, logging why it can't be read
+func readFrame(c net.Conn, frames *runtime.FrameReader) ([]byte, bool) {
+	if runtime.Config.IdleTimeout > 0 {
+		c.SetReadDeadline(time.Now().Add(runtime.Config.IdleTimeout))
+	}
+	frame, err := frames.ReadFrame()
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case err == io.EOF:
+		case errors.As(err, &netErr) && netErr.Timeout():
+			log.Printf("Closing idle connection %s\n", c.RemoteAddr())
+		default:
+			// the stream can't be trusted past a bad frame
+			log.Printf("Error reading request: %v\n", err)
 		}
+		return nil, false
+	}
+	if runtime.Config.Debug {
+		log.Printf("Raw bytes: % x\n", frame)
+	}
+	return frame, true
+}
 
-		// write to socket
-		c.Write(responseBytes)
+// Agree the protocol version & features from the client's opening hello;
+// returns false if the connection was refused
+func handshake(c net.Conn, frames *runtime.FrameReader) bool {
+	frame, ok := readFrame(c, frames)
+	if !ok {
+		return false
+	}
+	hello, err := runtime.DecodeHello(frame)
+	if err == nil {
+		hello, err = runtime.Negotiate(hello)
+	}
+	if err != nil {
+		log.Printf("Refusing connection %s: %v\n", c.RemoteAddr(), err)
+		c.Write(runtime.Frame(runtime.Refusal(err)))
+		return false
+	}
+	log.Printf("Connection %s agreed %s\n", c.RemoteAddr(), hello)
+	c.Write(runtime.Frame(hello))
+	return true
+}
 
-		// exit if command was to shut down
-		if request.GetAction() == runtime.Exit {
+// Serve requests from the connection until the client disconnects or it is
+// idle for longer than the configured timeout
+func handleConnection(ln net.Listener, c net.Conn) {
+	defer c.Close()
+	var tx transaction
+	frames := runtime.NewFrameReader(c)
+	if !handshake(c, frames) {
+		return
+	}
+	for {
+		frame, ok := readFrame(c, frames)
+		if !ok {
+			return
+		}
+		if len(frame) < runtime.RequestHeaderSize {
+			log.Printf("Error reading request: frame of %d bytes\n", len(frame))
+			return
+		}
+		request, err := runtime.DecodeRequest(frame)
+		if err != nil {
+			log.Printf("Error decoding request: %v\n", err)
+			writeResponse(c, runtime.ConstructResponse(
+				request,
+				runtime.InvalidRequest,
+				err.Error(),
+			))
+			continue
+		}
+		if handleRequest(c, &tx, request) {
 			ln.Close()
 			return
 		}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+	"github.com/EnemigoPython/go-getit/src/store"
+)
+
+// Frame of arbitrary bytes, for hellos this build would never send
+type rawFrame []byte
+
+func (f rawFrame) Encode() []byte { return f }
+
+// Open a connection with hello, returning whether the server accepted it &
+// the reply the client decoded
+func dialHello(t *testing.T, hello runtime.Framer) (bool, runtime.Hello, error) {
+	t.Helper()
+	server, client := net.Pipe()
+	defer client.Close()
+	accepted := make(chan bool, 1)
+	go func() {
+		defer server.Close()
+		accepted <- handshake(server, runtime.NewFrameReader(server))
+	}()
+	if _, err := client.Write(runtime.Frame(hello)); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := runtime.NewFrameReader(client).ReadFrame()
+	if err != nil {
+		t.Fatalf("no reply to %v: %v", hello, err)
+	}
+	reply, err := runtime.DecodeHelloReply(frame)
+	return <-accepted, reply, err
+}
+
+func TestHandshake(t *testing.T) {
+	accepted, reply, err := dialHello(t, runtime.NewHello())
+	if !accepted || err != nil {
+		t.Fatalf("current client refused: %v", err)
+	}
+	if reply.Features != runtime.SupportedFeatures {
+		t.Errorf("agreed features %s", reply.Features)
+	}
+
+	refused := map[string]runtime.Framer{
+		"old version": runtime.Hello{
+			Version:  runtime.ProtocolVersion - 1,
+			Features: runtime.SupportedFeatures,
+		},
+		"missing features": runtime.Hello{Version: runtime.ProtocolVersion},
+		"not a hello":      rawFrame("store k 1"),
+	}
+	for name, hello := range refused {
+		accepted, _, err := dialHello(t, hello)
+		var handshakeErr runtime.HandshakeError
+		if accepted || !errors.As(err, &handshakeErr) {
+			t.Errorf("%s: accepted %t with reply error %v", name, accepted, err)
+		}
+	}
+}
+
+func TestRefusalHidesOtherErrors(t *testing.T) {
+	refusal := runtime.Refusal(errors.New("internal detail"))
+	_, err := runtime.DecodeHelloReply(refusal.Encode())
+	var handshakeErr runtime.HandshakeError
+	if !errors.As(err, &handshakeErr) || strings.Contains(err.Error(), "internal detail") {
+		t.Errorf("refusal of another error read as %v", err)
+	}
+}
+
+// Open an empty store in a temporary directory for the test
+func openStore(t *testing.T) {
+	t.Helper()
+	runtime.UseStoreFile(filepath.Join(t.TempDir(), "store.bin"))
+	if err := store.OpenStore(); err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+}
+
+// Serve a connection for a fresh store over a pipe, returning the client side
+// once its hello has been agreed
+func connect(t *testing.T) (net.Conn, *runtime.FrameReader) {
+	t.Helper()
+	openStore(t)
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the listener is only closed by exit, which no test sends
+		handleConnection(nil, server)
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	frames := runtime.NewFrameReader(client)
+	if _, err := client.Write(runtime.Frame(runtime.NewHello())); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := frames.ReadFrame()
+	if err != nil {
+		t.Fatalf("no reply to hello: %v", err)
+	}
+	if _, err := runtime.DecodeHelloReply(frame); err != nil {
+		t.Fatalf("hello refused: %v", err)
+	}
+	return client, frames
+}
+
+// Send a frame & read the response to it
+func send(t *testing.T, c net.Conn, frames *runtime.FrameReader, f runtime.Framer) runtime.Response {
+	t.Helper()
+	if _, err := c.Write(runtime.Frame(f)); err != nil {
+		t.Fatalf("sending %v: %v", f, err)
+	}
+	frame, err := frames.ReadFrame()
+	if err != nil {
+		t.Fatalf("no response to %v: %v", f, err)
+	}
+	return runtime.DecodeResponse(frame)
+}
+
+func TestMalformedRequestIsAnswered(t *testing.T) {
+	c, frames := connect(t)
+	// a store whose key length runs past the end of the frame
+	response := send(t, c, frames, rawFrame{byte(runtime.Store), 0, 0, 0, 7, 200})
+	if response.GetStatus() != runtime.InvalidRequest || response.GetId() != 7 {
+		t.Errorf("malformed store gave %s for request %d", response.GetStatus(), response.GetId())
+	}
+	request, err := runtime.ConstructRequest([]string{"store", "k", "1"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := send(t, c, frames, request); response.GetStatus() != runtime.Ok {
+		t.Errorf("store after a malformed request gave %s", response.GetStatus())
+	}
+}
+
+func TestUnknownActionIsRefused(t *testing.T) {
+	c, frames := connect(t)
+	response := send(t, c, frames, rawFrame{byte(runtime.BulkSet) + 1, 0, 0, 0, 9})
+	if response.GetStatus() != runtime.InvalidRequest || response.GetId() != 9 {
+		t.Errorf("unknown action gave %s for request %d", response.GetStatus(), response.GetId())
+	}
+}
+
+func TestConnectionServesManyRequests(t *testing.T) {
+	c, frames := connect(t)
+	commands := []string{"store k 1", "add k 2", "load k", "keys"}
+	want := [][]runtime.Status{
+		{runtime.Ok},
+		{runtime.Ok},
+		{runtime.Ok},
+		{runtime.Ok, runtime.StreamDone},
+	}
+	for i, command := range commands {
+		request, err := runtime.ConstructRequest(strings.Fields(command), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := send(t, c, frames, request)
+		statuses := []runtime.Status{response.GetStatus()}
+		for !response.EndsStream() && request.IsStream() {
+			frame, err := frames.ReadFrame()
+			if err != nil {
+				t.Fatalf("%s stream cut short: %v", command, err)
+			}
+			response = runtime.DecodeResponse(frame)
+			statuses = append(statuses, response.GetStatus())
+		}
+		if !slices.Equal(statuses, want[i]) || response.GetId() != request.GetId() {
+			t.Errorf("%s gave %v for request %d", command, statuses, response.GetId())
+		}
+	}
+}
+
+func TestIdleConnectionIsClosed(t *testing.T) {
+	timeout := runtime.Config.IdleTimeout
+	runtime.Config.IdleTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { runtime.Config.IdleTimeout = timeout })
+	c, frames := connect(t)
+	start := time.Now()
+	if _, err := frames.ReadFrame(); err != io.EOF {
+		t.Fatalf("idle connection read gave %v; want it closed", err)
+	}
+	if idle := time.Since(start); idle > time.Second {
+		t.Errorf("idle connection closed after %s", idle)
+	}
+	if _, err := c.Write(runtime.Frame(rawFrame{byte(runtime.Count), 0, 0, 0, 1})); err == nil {
+		t.Error("write to a closed idle connection succeeded")
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+	"github.com/EnemigoPython/go-getit/src/store"
+)
+
+// Connection-scoped watch & queue state for transactions
+type transaction struct {
+	watched map[string]uint32 // modification stamps of watched keys
+	queued  []runtime.Request
+	active  bool // set between multi & exec/discard
+}
+
+func (t *transaction) reset() {
+	t.watched = nil
+	t.queued = nil
+	t.active = false
+}
+
+func invalidRequest(request runtime.Request, message string) []runtime.Response {
+	return []runtime.Response{
+		runtime.ConstructResponse(request, runtime.InvalidRequest, message),
+	}
+}
+
+// Handle a transaction control request, or queue a request inside multi
+func (t *transaction) handle(request runtime.Request) []runtime.Response {
+	switch request.GetAction() {
+	case runtime.Watch:
+		if t.active {
+			return invalidRequest(request, "Cannot watch inside multi")
+		}
+		if t.watched == nil {
+			t.watched = make(map[string]uint32)
+		}
+		return []runtime.Response{store.Watch(request, t.watched)}
+	case runtime.Unwatch:
+		t.watched = nil
+		return []runtime.Response{
+			runtime.ConstructResponse(request, runtime.Ok, 0),
+		}
+	case runtime.Multi:
+		if t.active {
+			return invalidRequest(request, "Multi cannot be nested")
+		}
+		t.active = true
+		return []runtime.Response{
+			runtime.ConstructResponse(request, runtime.Ok, 0),
+		}
+	case runtime.Exec:
+		if !t.active {
+			return invalidRequest(request, "Exec without multi")
+		}
+		responses := store.ProcessTransaction(request, t.queued, t.watched)
+		t.reset()
+		return responses
+	case runtime.Discard:
+		if !t.active {
+			return invalidRequest(request, "Discard without multi")
+		}
+		t.reset()
+		return []runtime.Response{
+			runtime.ConstructResponse(request, runtime.Ok, 0),
+		}
+	}
+	if !store.Queueable(request) {
+		return invalidRequest(
+			request,
+			fmt.Sprintf("%s cannot be queued in a transaction", request.GetAction()),
+		)
+	}
+	t.queued = append(t.queued, request)
+	return []runtime.Response{
+		runtime.ConstructResponse(request, runtime.Queued, 0),
+	}
+}
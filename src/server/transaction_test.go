@@ -0,0 +1,99 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+	"github.com/EnemigoPython/go-getit/src/store"
+)
+
+// Handle a command on the connection's transaction, returning the status
+// of each response
+func handle(t *testing.T, tx *transaction, command string) []runtime.Status {
+	t.Helper()
+	request, err := runtime.ConstructRequest(strings.Fields(command), false)
+	if err != nil {
+		t.Fatalf("ConstructRequest(%q): %v", command, err)
+	}
+	var statuses []runtime.Status
+	for _, response := range tx.handle(request) {
+		statuses = append(statuses, response.GetStatus())
+	}
+	return statuses
+}
+
+// Process a command as another connection would, outside any transaction
+func processElsewhere(t *testing.T, command string) runtime.Response {
+	t.Helper()
+	request, err := runtime.ConstructRequest(strings.Fields(command), false)
+	if err != nil {
+		t.Fatalf("ConstructRequest(%q): %v", command, err)
+	}
+	return store.ProcessRequest(request)
+}
+
+func TestTransaction(t *testing.T) {
+	tests := map[string]struct {
+		commands []string // handled on the connection, in order
+		change   int      // command before which another connection stores k
+		exec     []runtime.Status
+		after    string // value of k after exec
+	}{
+		"watched key changed": {
+			commands: []string{"watch k", "multi", "store k 3"},
+			change:   1,
+			exec:     []runtime.Status{runtime.Aborted},
+			after:    "2",
+		},
+		"watched key unchanged": {
+			commands: []string{"watch k", "multi", "store k 3"},
+			change:   -1,
+			exec:     []runtime.Status{runtime.Ok, runtime.StreamDone},
+			after:    "3",
+		},
+		"unwatched key changed": {
+			commands: []string{"watch k", "unwatch", "multi", "store k 3"},
+			change:   2,
+			exec:     []runtime.Status{runtime.Ok, runtime.StreamDone},
+			after:    "3",
+		},
+		"discard forgets queue & watches": {
+			commands: []string{
+				"watch k",
+				"multi",
+				"store k 9",
+				"discard",
+				"multi",
+				"store k 3",
+			},
+			change: 4,
+			exec:   []runtime.Status{runtime.Ok, runtime.StreamDone},
+			after:  "3",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			openStore(t)
+			processElsewhere(t, "store k 1")
+			var tx transaction
+			for i, command := range test.commands {
+				if i == test.change {
+					processElsewhere(t, "store k 2")
+				}
+				handle(t, &tx, command)
+			}
+			exec := handle(t, &tx, "exec")
+			if !slices.Equal(exec, test.exec) {
+				t.Errorf("exec gave %v", exec)
+			}
+			if tx.active || tx.queued != nil || tx.watched != nil {
+				t.Errorf("transaction state kept after exec: %+v", tx)
+			}
+			if after := processElsewhere(t, "load k").DataPayload(); after != test.after {
+				t.Errorf("k is %s after exec; want %s", after, test.after)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+const maxKeyLen = dataOffset - 2 // max bytes in a key
+
+// Check the raw bytes of a slot can be decoded as an entry
+func validateSlot(b []byte) error {
+	switch b[0] {
+	case slotEmpty, slotTombstone:
+		return nil
+	case slotSet:
+	default:
+		return fmt.Errorf("unknown slot state %d", b[0])
+	}
+	keyLen := int64(b[1])
+	if keyLen == 0 || keyLen > maxKeyLen {
+		return fmt.Errorf("bad key length %d", keyLen)
+	}
+	switch valueType(b[dataOffset]) {
+	case typeInt:
+	case typeString:
+		if valLen := b[dataOffset+1]; valLen > runtime.MaxStringLen {
+			return fmt.Errorf("bad string length %d", valLen)
+		}
+	default:
+		return fmt.Errorf("unknown value type %d", b[dataOffset])
+	}
+	return nil
+}
+
+// Whether a lookup of key from its home slot would resolve to slot, probing
+// as far as resolveEntry does
+func reachable(slots []decodedEntry, key string, slot int64) bool {
+	tableSpace := int64(len(slots) - 1)
+	index := hashKey(key, tableSpace)
+	for range tableSpace / 2 {
+		if index > tableSpace {
+			// wrap around as on reading past the end of the file
+			index = 1
+			continue
+		}
+		s := slots[index]
+		if !s.IsSet && !s.Tombstone {
+			return false
+		}
+		if s.IsSet && s.Key == key {
+			return index == slot
+		}
+		index++
+	}
+	return false
+}
+
+type storeCheck struct {
+	header     storeHeader
+	fileSize   int64
+	set        int64
+	tombstones int64
+	problems   []string
+	warnings   []string
+}
+
+func (c *storeCheck) problem(format string, a ...any) {
+	c.problems = append(c.problems, fmt.Sprintf(format, a...))
+}
+
+func (c *storeCheck) warn(format string, a ...any) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, a...))
+}
+
+// Read the header & every slot of a store file, recording anything that would
+// stop the server opening it or make entries unreachable
+func checkFile(fp *os.File) (*storeCheck, error) {
+	info, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	c := &storeCheck{fileSize: info.Size()}
+	if c.fileSize < entrySize {
+		c.problem("file of %d bytes has no header", c.fileSize)
+		return c, nil
+	}
+	c.header, err = readHeader(fp)
+	var headerErr StoreHeaderError
+	if errors.As(err, &headerErr) {
+		c.problem("%s", headerErr.errorStr)
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEntryWidth(fp, c.header, c.fileSize); err != nil {
+		c.problem("%v", err)
+		return c, nil
+	}
+	fileSlots := (c.fileSize / entrySize) - 1
+	if c.header.legacy {
+		c.warn("legacy header without table metadata; migrated on next start")
+		c.header.tableSpace = fileSlots
+		c.header.loadFactor = float64(c.header.entries) /
+			float64(c.header.tableSpace)
+	}
+	if c.fileSize%entrySize != 0 {
+		c.problem(
+			"file has %d trailing bytes after the last whole entry",
+			c.fileSize%entrySize,
+		)
+	}
+	if c.header.tableSpace < 1 {
+		c.problem("header table space is %d", c.header.tableSpace)
+		return c, nil
+	}
+	if fileSlots != c.header.tableSpace {
+		c.problem(
+			"header table space %d but file holds %d slots",
+			c.header.tableSpace,
+			fileSlots,
+		)
+	}
+
+	// slots missing from a short file are treated as empty
+	slots := make([]decodedEntry, c.header.tableSpace+1)
+	firstSlot := make(map[string]int64)
+	section := io.NewSectionReader(
+		fp,
+		entrySize,
+		min(fileSlots, c.header.tableSpace)*entrySize,
+	)
+	reader := bufio.NewReader(section)
+	buf := make([]byte, entrySize)
+	for slot := int64(1); slot <= min(fileSlots, c.header.tableSpace); slot++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		if err := validateSlot(buf); err != nil {
+			c.problem("slot %d: %v", slot, err)
+			// occupied as far as probing is concerned
+			slots[slot] = decodedEntry{Tombstone: true}
+			continue
+		}
+		decoded, _ := decodeFileBytes(buf)
+		decoded.Index = entryIndex(slot)
+		slots[slot] = decoded
+		if decoded.Tombstone {
+			c.tombstones++
+			continue
+		}
+		if !decoded.IsSet {
+			continue
+		}
+		c.set++
+		if decoded.Version > c.header.version {
+			c.problem(
+				"slot %d: key '%s' has stamp %d ahead of header stamp %d",
+				slot,
+				decoded.Key,
+				decoded.Version,
+				c.header.version,
+			)
+		}
+		if first, ok := firstSlot[decoded.Key]; ok {
+			c.problem(
+				"slot %d: key '%s' duplicates slot %d",
+				slot,
+				decoded.Key,
+				first,
+			)
+			continue
+		}
+		firstSlot[decoded.Key] = slot
+	}
+	for slot, s := range slots {
+		if !s.IsSet || firstSlot[s.Key] != int64(slot) {
+			continue
+		}
+		if !reachable(slots, s.Key, int64(slot)) {
+			c.problem(
+				"slot %d: key '%s' is unreachable from home slot %d",
+				slot,
+				s.Key,
+				hashKey(s.Key, c.header.tableSpace),
+			)
+		}
+	}
+	if c.set != c.header.entries {
+		c.problem(
+			"header counts %d entries but %d slots are set",
+			c.header.entries,
+			c.set,
+		)
+	}
+	loadFactor := float64(c.header.entries) / float64(c.header.tableSpace)
+	if math.Abs(c.header.loadFactor-loadFactor) > 1e-9 {
+		c.warn(
+			"header load factor %.4f does not match %.4f from its counts",
+			c.header.loadFactor,
+			loadFactor,
+		)
+	}
+	return c, nil
+}
+
+// Check the store file offline & print a report; returns false on problems
+func CheckStore() bool {
+	filePath := runtime.Config.StorePath
+	fp, err := os.Open(filePath)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	defer fp.Close()
+	c, err := checkFile(fp)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	fmt.Printf("store: %s (%d bytes)\n", filePath, c.fileSize)
+	fmt.Printf(
+		"header: table space %d, entries %d, stamp %d, load factor %.4f\n",
+		c.header.tableSpace,
+		c.header.entries,
+		c.header.version,
+		c.header.loadFactor,
+	)
+	fmt.Printf("slots: %d set, %d tombstones\n", c.set, c.tombstones)
+	for _, warning := range c.warnings {
+		fmt.Println("warning:", warning)
+	}
+	for _, problem := range c.problems {
+		fmt.Println("problem:", problem)
+	}
+	fmt.Printf("%d problems, %d warnings\n", len(c.problems), len(c.warnings))
+	return len(c.problems) == 0
+}
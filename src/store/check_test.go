@@ -0,0 +1,44 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+func TestValidateSlot(t *testing.T) {
+	valid := decodedEntry{IsSet: true, Key: "key", ValueType: typeString, Str: "value"}
+	if err := validateSlot(valid.toBytes()); err != nil {
+		t.Errorf("valid entry: %v", err)
+	}
+	corrupt := map[string]func(b []byte){
+		"state":       func(b []byte) { b[0] = 9 },
+		"key length":  func(b []byte) { b[1] = 0 },
+		"long key":    func(b []byte) { b[1] = byte(maxKeyLen + 1) },
+		"value type":  func(b []byte) { b[dataOffset] = 2 },
+		"long string": func(b []byte) { b[dataOffset+1] = runtime.MaxStringLen + 1 },
+	}
+	for name, corrupt := range corrupt {
+		b := valid.toBytes()
+		corrupt(b)
+		if err := validateSlot(b); err == nil {
+			t.Errorf("corrupt %s should fail", name)
+		}
+	}
+}
+
+func TestReachable(t *testing.T) {
+	const tableSpace = 10
+	slots := make([]decodedEntry, tableSpace+1)
+	home := hashKey("key", tableSpace)
+	next := home%tableSpace + 1
+	slots[home] = decodedEntry{Tombstone: true}
+	slots[next] = decodedEntry{IsSet: true, Key: "key"}
+	if !reachable(slots, "key", next) {
+		t.Errorf("key probed past a tombstone should be reachable")
+	}
+	slots[home] = decodedEntry{}
+	if reachable(slots, "key", next) {
+		t.Errorf("key past an empty home slot should be unreachable")
+	}
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+type tableStats struct {
+	entries        int64
+	tombstones     int64
+	probeTotal     int64
+	probeMax       int64
+	chains         int64         // runs of 2+ consecutive occupied slots
+	longestChain   int64         // slots in the longest run
+	probeHistogram map[int64]int // probe length -> number of keys
+}
+
+// Number of slots read to resolve a key in slot when its home is home
+func probeLength(home, slot, tableSpace int64) int64 {
+	return (slot-home+tableSpace)%tableSpace + 1
+}
+
+// Scan every slot of the table, measuring how far keys sit from their home
+// slot & how occupied slots cluster together
+func collectStats(fp *os.File) (tableStats, error) {
+	stats := tableStats{probeHistogram: make(map[int64]int)}
+	tableSpace := storeMetadata.tableSpace
+	section := io.NewSectionReader(fp, entrySize, tableSpace*entrySize)
+	reader := bufio.NewReader(section)
+	buf := make([]byte, entrySize)
+	// run lengths of occupied slots in table order; probes wrap around the
+	// end of the table so the first & last runs may be the same chain
+	var runs []int64
+	var run int64
+	occupiedFirst := false
+	for slot := int64(1); slot <= tableSpace; slot++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return tableStats{}, DecodeFileError{errorStr: err.Error()}
+		}
+		decoded, err := decodeFileBytes(buf)
+		if err != nil {
+			return tableStats{}, err
+		}
+		if !decoded.IsSet && !decoded.Tombstone {
+			if run > 0 {
+				runs = append(runs, run)
+			}
+			run = 0
+			continue
+		}
+		if slot == 1 {
+			occupiedFirst = true
+		}
+		run++
+		if decoded.Tombstone {
+			stats.tombstones++
+			continue
+		}
+		stats.entries++
+		probes := probeLength(hashKey(decoded.Key, tableSpace), slot, tableSpace)
+		stats.probeTotal += probes
+		stats.probeMax = max(stats.probeMax, probes)
+		stats.probeHistogram[probes]++
+	}
+	if run > 0 {
+		if occupiedFirst && len(runs) > 0 {
+			runs[0] += run
+		} else {
+			runs = append(runs, run)
+		}
+	}
+	for _, r := range runs {
+		if r > 1 {
+			stats.chains++
+		}
+		stats.longestChain = max(stats.longestChain, r)
+	}
+	return stats, nil
+}
+
+// Stream table diagnostics as space separated name & value rows
+func statsOperation(request runtime.Request, out chan<- runtime.Response) {
+	defer close(out)
+	fp, err := getReadPointer()
+	if err != nil {
+		out <- runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+		return
+	}
+	stats, err := collectStats(fp)
+	tableSpace := storeMetadata.tableSpace
+	lastResize := storeMetadata.lastResize
+	lastResizeDuration := storeMetadata.lastResizeDuration
+	fp.Close()
+	freeRLock()
+	if err != nil {
+		out <- runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+		return
+	}
+
+	var probeAvg float64
+	if stats.entries > 0 {
+		probeAvg = float64(stats.probeTotal) / float64(stats.entries)
+	}
+	resized := "never"
+	if !lastResize.IsZero() {
+		resized = lastResize.Format(time.RFC3339)
+	}
+	rows := []string{
+		fmt.Sprintf("entries %d", stats.entries),
+		fmt.Sprintf("table_space %d", tableSpace),
+		fmt.Sprintf(
+			"load_factor %.4f",
+			float64(stats.entries)/float64(tableSpace),
+		),
+		fmt.Sprintf("tombstones %d", stats.tombstones),
+		fmt.Sprintf("probe_avg %.4f", probeAvg),
+		fmt.Sprintf("probe_max %d", stats.probeMax),
+		fmt.Sprintf("collision_chains %d", stats.chains),
+		fmt.Sprintf("longest_chain %d", stats.longestChain),
+		fmt.Sprintf("last_resize %s", resized),
+		fmt.Sprintf("last_resize_duration %s", lastResizeDuration),
+	}
+	for probes := int64(1); probes <= stats.probeMax; probes++ {
+		if stats.probeHistogram[probes] == 0 {
+			continue
+		}
+		rows = append(
+			rows,
+			fmt.Sprintf("probe_hist_%d %d", probes, stats.probeHistogram[probes]),
+		)
+	}
+	for _, row := range rows {
+		out <- runtime.ConstructResponse(request, runtime.Ok, row)
+	}
+	out <- runtime.ConstructResponse(request, runtime.StreamDone, 0)
+}
+
+// Describe the state of a probed slot for explain
+func slotState(d decodedEntry) string {
+	switch {
+	case d.IsSet:
+		return fmt.Sprintf("key %s", d.Key)
+	case d.Tombstone:
+		return "tombstone"
+	default:
+		return "empty"
+	}
+}
+
+// Stream how a key resolves in the table: its hash, home slot, each slot
+// probed along the way & the slot it resolves to
+func explainOperation(request runtime.Request, out chan<- runtime.Response) {
+	defer close(out)
+	fp, err := getReadPointer()
+	if err != nil {
+		out <- runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+		return
+	}
+	key := request.GetKey()
+	home := hashKey(key, storeMetadata.tableSpace)
+	rows := []string{
+		fmt.Sprintf("hash %d", djb2(key)),
+		fmt.Sprintf("table_space %d", storeMetadata.tableSpace),
+		fmt.Sprintf("home_slot %d", home),
+	}
+	decoded, err := traceEntry(
+		entryIndex(home),
+		fp,
+		key,
+		func(d decodedEntry) {
+			rows = append(
+				rows,
+				fmt.Sprintf("probe %d %s", d.Index/entrySize, slotState(d)),
+			)
+		},
+	)
+	fp.Close()
+	freeRLock()
+	if err != nil {
+		out <- runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+		return
+	}
+	resolved := "free"
+	if decoded.IsSet {
+		resolved = "set"
+	}
+	rows = append(
+		rows,
+		fmt.Sprintf("resolved %d %s", decoded.Index/entrySize, resolved),
+	)
+	for _, row := range rows {
+		out <- runtime.ConstructResponse(request, runtime.Ok, row)
+	}
+	out <- runtime.ConstructResponse(request, runtime.StreamDone, 0)
+}
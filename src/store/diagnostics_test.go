@@ -0,0 +1,123 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Keys whose home is the given slot of the minimum table
+func keysHomedAt(slot int64, n int) []string {
+	var keys []string
+	for i := 0; len(keys) < n; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if hashKey(key, minTableSpace) == slot {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Rows of a diagnostics stream by name
+func statRows(t *testing.T, args ...string) map[string]string {
+	t.Helper()
+	rows := make(map[string]string)
+	for _, row := range processStream(t, args...) {
+		name, value, _ := strings.Cut(row, " ")
+		rows[name] = value
+	}
+	return rows
+}
+
+func TestStatsOfCollidingKeys(t *testing.T) {
+	tests := map[string]int64{
+		"chain":            minTableSpace / 2,
+		"wrapped chain":    minTableSpace, // runs on into slots 1 & 2
+		"ending at a wrap": minTableSpace - 2,
+	}
+	for name, home := range tests {
+		t.Run(name, func(t *testing.T) {
+			openTestStore(t)
+			for _, key := range keysHomedAt(home, 3) {
+				process(t, "store", key, "1")
+			}
+			rows := statRows(t, "stats")
+			want := map[string]string{
+				"entries":          "3",
+				"probe_max":        "3",
+				"probe_avg":        "2.0000",
+				"collision_chains": "1",
+				"longest_chain":    "3",
+				"probe_hist_1":     "1",
+				"probe_hist_2":     "1",
+				"probe_hist_3":     "1",
+			}
+			for name, value := range want {
+				if rows[name] != value {
+					t.Errorf("%s is %q; want %q", name, rows[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestStatsCountsSeparateChains(t *testing.T) {
+	openTestStore(t)
+	// a lone key between two chains, one wrapping around the table's end
+	keys := append(keysHomedAt(minTableSpace, 2), keysHomedAt(10, 1)...)
+	keys = append(keys, keysHomedAt(20, 3)...)
+	for _, key := range keys {
+		process(t, "store", key, "1")
+	}
+	process(t, "clear", keys[len(keys)-1])
+	rows := statRows(t, "stats")
+	want := map[string]string{
+		"entries":          "5",
+		"tombstones":       "1",
+		"collision_chains": "2",
+		"longest_chain":    "3",
+		"probe_max":        "2",
+	}
+	for name, value := range want {
+		if rows[name] != value {
+			t.Errorf("%s is %q; want %q", name, rows[name], value)
+		}
+	}
+}
+
+func TestExplainProbes(t *testing.T) {
+	openTestStore(t)
+	home := minTableSpace
+	keys := keysHomedAt(home, 4)
+	for _, key := range keys[:3] {
+		process(t, "store", key, "1")
+	}
+	process(t, "clear", keys[1])
+	tests := map[string][]string{
+		keys[2]: {
+			fmt.Sprintf("home_slot %d", home),
+			fmt.Sprintf("probe %d key %s", home, keys[0]),
+			"probe 1 tombstone",
+			fmt.Sprintf("probe 2 key %s", keys[2]),
+			"resolved 2 set",
+		},
+		// a missing key probes to the end of the chain, then resolves to
+		// the tombstone it would be stored in
+		keys[3]: {
+			fmt.Sprintf("home_slot %d", home),
+			fmt.Sprintf("probe %d key %s", home, keys[0]),
+			"probe 1 tombstone",
+			fmt.Sprintf("probe 2 key %s", keys[2]),
+			"probe 3 empty",
+			"resolved 1 free",
+		},
+	}
+	for key, want := range tests {
+		rows := processStream(t, "explain", key)
+		// the hash & table space rows come first
+		if len(rows) < 2 || !slices.Equal(rows[2:], want) {
+			t.Errorf("explain %s gave\n%s", key, strings.Join(rows, "\n"))
+		}
+	}
+}
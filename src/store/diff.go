@@ -0,0 +1,229 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+const mergeBatchSize = 500 // entries per bulkset request when merging
+
+// The int or string value of a set entry
+func (d decodedEntry) value() any {
+	switch d.ValueType {
+	case typeInt:
+		return d.Int
+	case typeString:
+		return d.Str
+	}
+	panic("Unreachable")
+}
+
+// Format the value of a set entry with its type
+func (d decodedEntry) typedValue() string {
+	switch d.ValueType {
+	case typeInt:
+		return fmt.Sprintf("int %d", d.Int)
+	case typeString:
+		return fmt.Sprintf("string %s", strconv.Quote(d.Str))
+	}
+	panic("Unreachable")
+}
+
+// Read the set entries of a store file offline, refusing files that the
+// server would refuse to open or that hold undecodable slots
+func readStoreFile(path string) (map[string]decodedEntry, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	info, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header, err := readHeader(fp)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEntryWidth(fp, header, info.Size()); err != nil {
+		return nil, err
+	}
+	if header.legacy {
+		header.tableSpace = (info.Size() / entrySize) - 1
+	}
+	if err := header.validate(info.Size()); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]decodedEntry, header.entries)
+	reader := bufio.NewReader(
+		io.NewSectionReader(fp, entrySize, header.tableSpace*entrySize),
+	)
+	buf := make([]byte, entrySize)
+	for slot := int64(1); slot <= header.tableSpace; slot++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		if err := validateSlot(buf); err != nil {
+			return nil, fmt.Errorf(
+				"%s slot %d: %v (run with --runtime=check for a full report)",
+				path,
+				slot,
+				err,
+			)
+		}
+		decoded, _ := decodeFileBytes(buf)
+		if !decoded.IsSet {
+			continue
+		}
+		if kept, ok := entries[decoded.Key]; ok && kept.Version > decoded.Version {
+			continue
+		}
+		entries[decoded.Key] = decoded
+	}
+	return entries, nil
+}
+
+// Sorted keys only in b, only in a & in both with different typed values
+func diffEntries(a, b map[string]decodedEntry) ([]string, []string, []string) {
+	var added, removed, changed []string
+	for key, entryB := range b {
+		entryA, ok := a[key]
+		if !ok {
+			added = append(added, key)
+		} else if !entryA.matches(entryB.value()) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
+	return added, removed, changed
+}
+
+// Print the keys added, removed & changed going from store file a to b;
+// returns whether the stores differ
+func DiffStores(pathA, pathB string) (bool, error) {
+	a, err := readStoreFile(pathA)
+	if err != nil {
+		return false, err
+	}
+	b, err := readStoreFile(pathB)
+	if err != nil {
+		return false, err
+	}
+	added, removed, changed := diffEntries(a, b)
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for _, key := range added {
+		fmt.Fprintf(w, "+ %s %s\n", key, b[key].typedValue())
+	}
+	for _, key := range removed {
+		fmt.Fprintf(w, "- %s %s\n", key, a[key].typedValue())
+	}
+	for _, key := range changed {
+		fmt.Fprintf(
+			w,
+			"~ %s %s -> %s\n",
+			key,
+			a[key].typedValue(),
+			b[key].typedValue(),
+		)
+	}
+	fmt.Fprintf(
+		w,
+		"%d added, %d removed, %d changed\n",
+		len(added),
+		len(removed),
+		len(changed),
+	)
+	return len(added)+len(removed)+len(changed) > 0, nil
+}
+
+type MergeStrategy int
+
+const (
+	MergeOurs   MergeStrategy = iota // keep the target value of changed keys
+	MergeTheirs                      // take the source value of changed keys
+	MergeNewest                      // take whichever value was written last
+)
+
+func ParseMergeStrategy(s string) (MergeStrategy, error) {
+	switch s {
+	case "ours":
+		return MergeOurs, nil
+	case "theirs":
+		return MergeTheirs, nil
+	case "newest":
+		return MergeNewest, nil
+	}
+	return 0, fmt.Errorf("merge strategy must be ours, theirs or newest: %s", s)
+}
+
+// Apply the keys of store file src missing from or changed in store file
+// dst, writing through the store as the server would. Keys only in dst are
+// kept; changed keys are resolved by strategy
+func MergeStores(src, dst string, strategy MergeStrategy) error {
+	srcEntries, err := readStoreFile(src)
+	if err != nil {
+		return err
+	}
+	dstEntries, err := readStoreFile(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	added, _, changed := diffEntries(dstEntries, srcEntries)
+	keys := added
+	for _, key := range changed {
+		switch strategy {
+		case MergeTheirs:
+			keys = append(keys, key)
+		case MergeNewest:
+			if srcEntries[key].Modified > dstEntries[key].Modified {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+
+	runtime.UseStoreFile(dst)
+	if err := OpenStore(); err != nil {
+		return err
+	}
+	// every key is known up front, so resize once for the whole merge
+	reserveSpace(int64(len(keys)))
+	for i := 0; i < len(keys); i += mergeBatchSize {
+		end := min(i+mergeBatchSize, len(keys))
+		pairs := make([]any, 0, (end-i)*2)
+		for _, key := range keys[i:end] {
+			pairs = append(pairs, key, srcEntries[key].value())
+		}
+		request, err := runtime.NewBulkSetRequest(pairs)
+		if err != nil {
+			return err
+		}
+		response := ProcessRequest(request)
+		if response.GetStatus() != runtime.Ok {
+			return fmt.Errorf("merge into %s failed: %v", dst, response)
+		}
+	}
+	fmt.Printf(
+		"merged %d keys into %s (%d added, %d changed, %d kept)\n",
+		len(keys),
+		dst,
+		len(added),
+		len(keys)-len(added),
+		len(changed)-(len(keys)-len(added)),
+	)
+	return nil
+}
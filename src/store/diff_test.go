@@ -0,0 +1,89 @@
+package store
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// Write a store file at path holding the result of each command
+func writeTestStore(t *testing.T, path string, commands ...[]string) {
+	t.Helper()
+	runtime.UseStoreFile(path)
+	if err := OpenStore(); err != nil {
+		t.Fatalf("OpenStore(%s): %v", path, err)
+	}
+	t.Cleanup(indexReset)
+	for _, command := range commands {
+		process(t, command...)
+	}
+}
+
+func TestDiffStores(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin")
+	writeTestStore(t, a, []string{"store", "same", "1"}, []string{"store", "gone", "x"},
+		[]string{"store", "changed", "1"})
+	writeTestStore(t, b, []string{"store", "same", "1"}, []string{"store", "new", "2"},
+		[]string{"store", "changed", "one"})
+
+	entriesA, err := readStoreFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entriesB, err := readStoreFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, removed, changed := diffEntries(entriesA, entriesB)
+	if !slices.Equal(added, []string{"new"}) ||
+		!slices.Equal(removed, []string{"gone"}) ||
+		!slices.Equal(changed, []string{"changed"}) {
+		t.Errorf("diff gave +%v -%v ~%v", added, removed, changed)
+	}
+	if differ, err := DiffStores(a, b); err != nil || !differ {
+		t.Errorf("DiffStores(a, b) = %v, %v", differ, err)
+	}
+	if differ, err := DiffStores(a, a); err != nil || differ {
+		t.Errorf("DiffStores(a, a) = %v, %v", differ, err)
+	}
+}
+
+func TestMergeStores(t *testing.T) {
+	tests := []struct {
+		strategy MergeStrategy
+		want     map[string]any
+	}{
+		{MergeOurs, map[string]any{"x": 5, "y": 2, "z": 3}},
+		{MergeTheirs, map[string]any{"x": 1, "y": 2, "z": 3}},
+		// dst is written last, so its value is never older
+		{MergeNewest, map[string]any{"x": 5, "y": 2, "z": 3}},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		src, dst := filepath.Join(dir, "src.bin"), filepath.Join(dir, "dst.bin")
+		writeTestStore(t, src, []string{"store", "x", "1"}, []string{"store", "y", "2"})
+		writeTestStore(t, dst, []string{"store", "x", "5"}, []string{"store", "z", "3"})
+		if err := MergeStores(src, dst, test.strategy); err != nil {
+			t.Fatalf("MergeStores(%d): %v", test.strategy, err)
+		}
+		entries, err := readStoreFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]any, len(entries))
+		for key, d := range entries {
+			got[key] = d.value()
+		}
+		for key, value := range test.want {
+			if got[key] != value {
+				t.Errorf("strategy %d: %s = %v, want %v", test.strategy, key, got[key], value)
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("strategy %d merged to %v", test.strategy, got)
+		}
+	}
+}
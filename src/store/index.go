@@ -0,0 +1,147 @@
+package store
+
+import (
+	"math/rand/v2"
+	"os"
+	"strings"
+)
+
+const maxIndexLevel = 32
+
+// Node of the key index; next holds a link for every level the node is on
+type indexNode struct {
+	key  string
+	next []*indexNode
+}
+
+// Skip list of keys for ordered scans, so inserts & removals stay
+// logarithmic however large the store grows
+type skipList struct {
+	head   indexNode
+	level  int
+	length int
+}
+
+func newSkipList() *skipList {
+	return &skipList{head: indexNode{next: make([]*indexNode, maxIndexLevel)}, level: 1}
+}
+
+// Find the first node with a key at or after key; when update is given it is
+// filled with the last node before it on each level
+func (l *skipList) seek(key string, update []*indexNode) *indexNode {
+	node := &l.head
+	for level := l.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].key < key {
+			node = node.next[level]
+		}
+		if update != nil {
+			update[level] = node
+		}
+	}
+	return node.next[0]
+}
+
+func (l *skipList) insert(key string) {
+	update := make([]*indexNode, maxIndexLevel)
+	if node := l.seek(key, update); node != nil && node.key == key {
+		return
+	}
+	level := 1
+	for level < maxIndexLevel && rand.IntN(4) == 0 {
+		level++
+	}
+	for ; l.level < level; l.level++ {
+		update[l.level] = &l.head
+	}
+	node := &indexNode{key: key, next: make([]*indexNode, level)}
+	for i := range level {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	l.length++
+}
+
+func (l *skipList) remove(key string) {
+	update := make([]*indexNode, maxIndexLevel)
+	node := l.seek(key, update)
+	if node == nil || node.key != key {
+		return
+	}
+	for i := range node.next {
+		update[i].next[i] = node.next[i]
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.length--
+}
+
+// Sorted keys for ordered scans; guarded by the store mutex like the file
+var keyIndex = newSkipList()
+
+func indexInsert(key string) {
+	keyIndex.insert(key)
+}
+
+func indexRemove(key string) {
+	keyIndex.remove(key)
+}
+
+func indexReset() {
+	keyIndex = newSkipList()
+}
+
+// Scan every slot of the table to rebuild the key & value indexes & count
+// its tombstones
+func buildIndexes(fp *os.File) error {
+	indexReset()
+	if err := loadValueIndexes(); err != nil {
+		return err
+	}
+	for index := entrySize; index < storeMetadata.size; index += entrySize {
+		decoded, err := readEntry(index, fp, false)
+		if err != nil {
+			return err
+		}
+		if decoded.IsSet {
+			indexInsert(decoded.Key)
+			valueIndexSet(decoded)
+		}
+		if decoded.Tombstone {
+			storeMetadata.tombstones++
+		}
+	}
+	return nil
+}
+
+// Every key in sorted order
+func indexKeys() []string {
+	keys := make([]string, 0, keyIndex.length)
+	for node := keyIndex.head.next[0]; node != nil; node = node.next[0] {
+		keys = append(keys, node.key)
+	}
+	return keys
+}
+
+// Keys in [start, end) in sorted order; an empty end is unbounded and a
+// limit of 0 returns every key in range
+func indexRange(start string, end string, limit int) []string {
+	var keys []string
+	for node := keyIndex.seek(start, nil); node != nil; node = node.next[0] {
+		if end != "" && node.key >= end || limit > 0 && len(keys) == limit {
+			break
+		}
+		keys = append(keys, node.key)
+	}
+	return keys
+}
+
+// Keys starting with prefix in sorted order
+func indexPrefix(prefix string) []string {
+	var keys []string
+	node := keyIndex.seek(prefix, nil)
+	for ; node != nil && strings.HasPrefix(node.key, prefix); node = node.next[0] {
+		keys = append(keys, node.key)
+	}
+	return keys
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestIndexScans(t *testing.T) {
+	defer indexReset()
+	for _, key := range []string{"m", "session:b", "apple", "session:a", "mango"} {
+		indexInsert(key)
+	}
+	indexInsert("apple")
+	indexRemove("missing")
+
+	if got := indexPrefix("session:"); !slices.Equal(got, []string{"session:a", "session:b"}) {
+		t.Errorf("indexPrefix = %v", got)
+	}
+	if got := indexRange("a", "m", 0); !slices.Equal(got, []string{"apple"}) {
+		t.Errorf("indexRange = %v", got)
+	}
+	if got := indexRange("b", "", 2); !slices.Equal(got, []string{"m", "mango"}) {
+		t.Errorf("indexRange with limit = %v", got)
+	}
+	if got := indexRange("z", "a", 0); len(got) != 0 {
+		t.Errorf("indexRange with end before start = %v", got)
+	}
+}
+
+func TestIndexStaysSorted(t *testing.T) {
+	defer indexReset()
+	want := map[string]bool{}
+	for range 5000 {
+		key := fmt.Sprintf("key:%d", rand.IntN(1000))
+		if rand.IntN(3) == 0 {
+			indexRemove(key)
+			delete(want, key)
+		} else {
+			indexInsert(key)
+			want[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(want))
+	for key := range want {
+		sorted = append(sorted, key)
+	}
+	slices.Sort(sorted)
+	if got := indexKeys(); !slices.Equal(got, sorted) {
+		t.Fatalf("index holds %d keys, want %d in order", len(got), len(sorted))
+	}
+	if got := indexRange("key:2", "key:5", 0); !slices.Equal(got, sortedRange(sorted, "key:2", "key:5")) {
+		t.Errorf("indexRange = %v", got)
+	}
+}
+
+func sortedRange(sorted []string, start string, end string) []string {
+	from, _ := slices.BinarySearch(sorted, start)
+	to, _ := slices.BinarySearch(sorted, end)
+	return sorted[from:to]
+}
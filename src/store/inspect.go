@@ -0,0 +1,205 @@
+package store
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// Which slots of the store file to dump & how
+type InspectOptions struct {
+	FirstSlot int64  // first slot to dump, from 1
+	LastSlot  int64  // last slot to dump; 0 for the end of the file
+	Pattern   string // glob pattern keys must match; empty for every slot
+	JSON      bool
+}
+
+type inspectedHeader struct {
+	Entries    int64   `json:"entries"`
+	Stamp      uint32  `json:"stamp"`
+	TableSpace int64   `json:"table_space"`
+	LoadFactor float64 `json:"load_factor"`
+	Generation uint32  `json:"generation"`
+	Legacy     bool    `json:"legacy,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type inspectedSlot struct {
+	Slot     int64  `json:"slot"`
+	State    string `json:"state"`
+	Key      string `json:"key,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Value    any    `json:"value,omitempty"`
+	Home     int64  `json:"home,omitempty"`
+	Distance *int64 `json:"distance,omitempty"`
+	Stamp    uint32 `json:"stamp,omitempty"`
+	Modified string `json:"modified,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Raw      string `json:"raw,omitempty"` // hex bytes of an invalid slot
+}
+
+func (s inspectedSlot) String() string {
+	switch s.State {
+	case "set":
+		return fmt.Sprintf(
+			"slot %d set key=%s type=%s value=%v home=%d distance=%d "+
+				"stamp=%d modified=%s",
+			s.Slot,
+			s.Key,
+			s.Type,
+			s.Value,
+			s.Home,
+			*s.Distance,
+			s.Stamp,
+			s.Modified,
+		)
+	case "invalid":
+		return fmt.Sprintf("slot %d invalid (%s) %s", s.Slot, s.Error, s.Raw)
+	}
+	return fmt.Sprintf("slot %d %s", s.Slot, s.State)
+}
+
+// Describe the raw bytes of a slot in a table of tableSpace slots
+func inspectSlot(slot int64, b []byte, tableSpace int64) inspectedSlot {
+	s := inspectedSlot{Slot: slot}
+	if err := validateSlot(b); err != nil {
+		s.State, s.Error, s.Raw = "invalid", err.Error(), hex.EncodeToString(b)
+		return s
+	}
+	decoded, _ := decodeFileBytes(b)
+	switch {
+	case decoded.Tombstone:
+		s.State = "tombstone"
+		return s
+	case !decoded.IsSet:
+		s.State = "empty"
+		return s
+	}
+	s.State, s.Key = "set", decoded.Key
+	switch decoded.ValueType {
+	case typeInt:
+		s.Type, s.Value = "int", decoded.Int
+	case typeString:
+		s.Type, s.Value = "string", decoded.Str
+	}
+	s.Home = hashKey(decoded.Key, tableSpace)
+	distance := probeLength(s.Home, slot, tableSpace) - 1
+	s.Distance = &distance
+	s.Stamp = decoded.Version
+	s.Modified = time.Unix(decoded.Modified, 0).UTC().Format(time.RFC3339)
+	return s
+}
+
+// Describe the header & the slots of a store file chosen by options, without
+// needing a valid header
+func inspectFile(
+	fp *os.File,
+	options InspectOptions,
+) (inspectedHeader, []inspectedSlot, error) {
+	info, err := fp.Stat()
+	if err != nil {
+		return inspectedHeader{}, nil, err
+	}
+	fileSlots := max((info.Size()/entrySize)-1, 0)
+
+	var header inspectedHeader
+	h, err := readHeader(fp)
+	if err == nil {
+		err = checkEntryWidth(fp, h, info.Size())
+	}
+	if err != nil {
+		header.Error = err.Error()
+	}
+	header.Entries, header.Stamp = h.entries, h.version
+	header.TableSpace, header.LoadFactor = h.tableSpace, h.loadFactor
+	header.Generation = h.generation
+	if h.legacy || err != nil {
+		// hash against the slots the file holds
+		header.Legacy = h.legacy
+		header.TableSpace = fileSlots
+	}
+
+	last := fileSlots
+	var preStamp PreStampStoreError
+	if errors.As(err, &preStamp) {
+		// slots can't be read at the current entry width
+		last = 0
+	}
+	if options.LastSlot > 0 {
+		last = min(options.LastSlot, fileSlots)
+	}
+	first := max(options.FirstSlot, 1)
+	slots := []inspectedSlot{}
+	if first <= last {
+		reader := bufio.NewReader(io.NewSectionReader(
+			fp,
+			entryIndex(first),
+			(last-first+1)*entrySize,
+		))
+		buf := make([]byte, entrySize)
+		for slot := first; slot <= last; slot++ {
+			if _, err := io.ReadFull(reader, buf); err != nil {
+				return inspectedHeader{}, nil, err
+			}
+			s := inspectSlot(slot, buf, max(header.TableSpace, 1))
+			if options.Pattern != "" &&
+				(s.State != "set" || !runtime.MatchPattern(options.Pattern, s.Key)) {
+				continue
+			}
+			slots = append(slots, s)
+		}
+	}
+	return header, slots, nil
+}
+
+// Dump the header & slots of the store file offline, without needing a
+// valid header; returns false if the file could not be read
+func InspectStore(options InspectOptions) bool {
+	fp, err := os.Open(runtime.Config.StorePath)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	defer fp.Close()
+	header, slots, err := inspectFile(fp, options)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	if options.JSON {
+		b, _ := json.MarshalIndent(struct {
+			Header inspectedHeader `json:"header"`
+			Slots  []inspectedSlot `json:"slots"`
+		}{header, slots}, "", "  ")
+		fmt.Fprintln(w, string(b))
+		return true
+	}
+	headerRow := []string{
+		fmt.Sprintf("entries=%d", header.Entries),
+		fmt.Sprintf("stamp=%d", header.Stamp),
+		fmt.Sprintf("table_space=%d", header.TableSpace),
+		fmt.Sprintf("load_factor=%.4f", header.LoadFactor),
+		fmt.Sprintf("generation=%d", header.Generation),
+	}
+	if header.Legacy {
+		headerRow = append(headerRow, "legacy")
+	}
+	fmt.Fprintf(w, "header %s\n", strings.Join(headerRow, " "))
+	if header.Error != "" {
+		fmt.Fprintf(w, "header error: %s\n", header.Error)
+	}
+	for _, s := range slots {
+		fmt.Fprintln(w, s)
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+func TestInspectFile(t *testing.T) {
+	openTestStore(t)
+	for _, key := range []string{"a", "b", "user:1", "user:2"} {
+		process(t, "store", key, "1")
+	}
+	process(t, "clear", "b")
+	fp, err := os.Open(runtime.Config.StorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+
+	header, slots, err := inspectFile(fp, InspectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Error != "" || header.Entries != 3 || header.TableSpace != minTableSpace {
+		t.Errorf("header %+v", header)
+	}
+	if len(slots) != int(minTableSpace) {
+		t.Fatalf("%d slots dumped from a table of %d", len(slots), minTableSpace)
+	}
+	states := make(map[string]int)
+	for _, s := range slots {
+		states[s.State]++
+		if s.State == "set" && (s.Home != hashKey(s.Key, minTableSpace) || s.Stamp == 0) {
+			t.Errorf("set slot %+v", s)
+		}
+	}
+	if states["set"] != 3 || states["tombstone"] != 1 || states["invalid"] != 0 {
+		t.Errorf("slot states %v", states)
+	}
+
+	home := hashKey("a", minTableSpace)
+	_, slots, _ = inspectFile(fp, InspectOptions{FirstSlot: home, LastSlot: home})
+	if len(slots) != 1 || slots[0].Slot != home || slots[0].Key != "a" {
+		t.Errorf("single slot %d dumped as %+v", home, slots)
+	}
+
+	_, slots, _ = inspectFile(fp, InspectOptions{Pattern: "user:*"})
+	var keys []string
+	for _, s := range slots {
+		keys = append(keys, s.Key)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"user:1", "user:2"}) {
+		t.Errorf("pattern matched %v", keys)
+	}
+}
+
+func TestInspectCorruptSlot(t *testing.T) {
+	openTestStore(t)
+	process(t, "store", "a", "1")
+	home := hashKey("a", minTableSpace)
+	fp, err := os.OpenFile(runtime.Config.StorePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	fp.WriteAt([]byte{9}, entryIndex(home))
+
+	_, slots, err := inspectFile(fp, InspectOptions{FirstSlot: home, LastSlot: home})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 1 || slots[0].State != "invalid" || slots[0].Raw == "" {
+		t.Errorf("corrupt slot dumped as %+v", slots)
+	}
+}
@@ -6,20 +6,28 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/EnemigoPython/go-getit/src/runtime"
 	"github.com/EnemigoPython/go-getit/src/types"
 )
 
-const entrySize int64 = 66             // number of bytes in file entry encoding
+const entrySize int64 = 74             // number of bytes in file entry encoding
+const dataOffset int64 = 33            // offset of value record in entry
+const stampOffset int64 = 66           // offset of modification stamp in entry
 const minTableSpace int64 = 50         // default hash & file size limit
 const sizeUpThreshold float64 = 0.4    // % full to trigger resize up
 const sizeDownThreshold float64 = 0.05 // % empty to trigger resize down
 const streamBufferSize = 100           // size of stream channel
 const workerCount = 10                 // number of workers for stream
+const cursorSlotBits = 24              // bits of a scan cursor for the slot
+
+// table generations that fit in the remaining bits of a scan cursor
+const cursorGenerations = 1 << (31 - cursorSlotBits)
 
 var notFoundFilter = []runtime.Status{runtime.NotFound}
 
@@ -27,14 +35,26 @@ type _storeMetadata struct {
 	size       int64   // size in bytes
 	tableSpace int64   // current table space
 	entries    int64   // number of entries
+	tombstones int64   // cleared slots not yet reused or rehashed away
 	setRatio   float64 // ratio of entries set in table
 	minSize    int64   // memoized minimum file size in bytes
+	version    uint32  // last modification stamp issued
+	generation uint32  // incremented whenever the table is rebuilt
+
+	lastResize         time.Time     // when the table was last rebuilt
+	lastResizeDuration time.Duration // how long the last rebuild took
 }
 
 var storeMetadata _storeMetadata
 
 var mutex sync.RWMutex
 
+// Serialises resizes, which all rebuild the table in the same temp file
+var resizeMutex sync.Mutex
+
+// Resize checks started in the background after writes
+var pendingResizes sync.WaitGroup
+
 func getReadPointer() (*os.File, error) {
 	filePath := runtime.Config.StorePath
 	fp, err := os.Open(filePath)
@@ -59,58 +79,277 @@ func acquireLock() { mutex.Lock() }
 func freeLock()    { mutex.Unlock() }
 func freeRLock()   { mutex.RUnlock() }
 
-func readMetaBytes(fp *os.File, minSize int64) int64 {
-	// read first 4 bytes to get number of entries
-	buf := make([]byte, 4)
-	_, err := fp.Read(buf)
-	if err != nil {
-		// new store; write empty metadata + min table space
-		newMetaBytes := make([]byte, minSize)
-		fp.Write(newMetaBytes)
+// Layout of the header (entry 0); the rest of the entry is reserved
+const (
+	headerEntriesOffset    = 0  // int32 number of entries
+	headerVersionOffset    = 4  // uint32 last modification stamp issued
+	headerMagicOffset      = 8  // marks a header with persisted table metadata
+	headerFormatOffset     = 12 // header format version
+	headerEntrySizeOffset  = 13 // entry size the table was written with
+	headerTableSpaceOffset = 14 // uint32 table space
+	headerLoadFactorOffset = 18 // float64 ratio of entries set in table
+	headerGenerationOffset = 26 // uint32 table generation for scan cursors
+)
+
+const headerMagic = "gtit"
+const headerFormat byte = 1
+
+type StoreHeaderError struct {
+	errorStr string
+}
+
+func (e StoreHeaderError) Error() string {
+	return fmt.Sprintf(
+		"Error opening store; %s (run with --runtime=check for a full "+
+			"report & --runtime=repair to rebuild the store)",
+		e.errorStr,
+	)
+}
+
+type storeHeader struct {
+	entries    int64
+	version    uint32
+	tableSpace int64
+	loadFactor float64
+	generation uint32
+	legacy     bool // written before table metadata was persisted
+}
+
+func readHeader(fp *os.File) (storeHeader, error) {
+	buf := make([]byte, entrySize)
+	if _, err := fp.ReadAt(buf, 0); err != nil {
+		return storeHeader{}, StoreHeaderError{errorStr: "header is incomplete"}
+	}
+	header := storeHeader{
+		entries: int64(int32(binary.BigEndian.Uint32(buf[headerEntriesOffset:]))),
+		version: binary.BigEndian.Uint32(buf[headerVersionOffset:]),
+	}
+	magic := buf[headerMagicOffset : headerMagicOffset+len(headerMagic)]
+	if string(magic) != headerMagic {
+		header.legacy = true
+		return header, nil
+	}
+	if buf[headerFormatOffset] != headerFormat {
+		return storeHeader{}, StoreHeaderError{
+			errorStr: fmt.Sprintf(
+				"unsupported header format %d",
+				buf[headerFormatOffset],
+			),
+		}
+	}
+	if int64(buf[headerEntrySizeOffset]) != entrySize {
+		return storeHeader{}, StoreHeaderError{
+			errorStr: fmt.Sprintf(
+				"entries are %d bytes but this version uses %d",
+				buf[headerEntrySizeOffset],
+				entrySize,
+			),
+		}
 	}
-	entries := int32(binary.BigEndian.Uint32(buf))
-	return int64(entries)
+	header.tableSpace = int64(
+		binary.BigEndian.Uint32(buf[headerTableSpaceOffset:]),
+	)
+	header.loadFactor = math.Float64frombits(
+		binary.BigEndian.Uint64(buf[headerLoadFactorOffset:]),
+	)
+	header.generation = binary.BigEndian.Uint32(buf[headerGenerationOffset:])
+	return header, nil
 }
 
-// Check size ratio against resize parameters; initiate resize if needed
-func checkResizeUp() {
-	storeMetadata.setRatio = float64(storeMetadata.entries) /
-		float64(storeMetadata.tableSpace)
-	if storeMetadata.setRatio <= sizeUpThreshold {
-		return
+// Check the header describes a table that fits the file exactly
+func (h storeHeader) validate(fileSize int64) error {
+	expectedSize := (h.tableSpace * entrySize) + entrySize
+	if h.tableSpace < 1 || fileSize != expectedSize {
+		return StoreHeaderError{
+			errorStr: fmt.Sprintf(
+				"header table space %d needs a file of %d bytes, found %d",
+				h.tableSpace,
+				expectedSize,
+				fileSize,
+			),
+		}
+	}
+	if h.entries < 0 || h.entries > h.tableSpace {
+		return StoreHeaderError{
+			errorStr: fmt.Sprintf(
+				"header counts %d entries in a table space of %d",
+				h.entries,
+				h.tableSpace,
+			),
+		}
+	}
+	return nil
+}
+
+// Write the table space & load factor of a table to file metadata
+func writeTableBytes(fp *os.File, tableSpace int64, entries int64) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(headerMagic)
+	buf.WriteByte(headerFormat)
+	buf.WriteByte(byte(entrySize))
+	binary.Write(buf, binary.BigEndian, uint32(tableSpace))
+	binary.Write(buf, binary.BigEndian, float64(entries)/float64(tableSpace))
+	fp.WriteAt(buf.Bytes(), headerMagicOffset)
+}
+
+// Read the number of entries & table space under the read lock
+func tableLoad() (int64, int64, int64) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return storeMetadata.entries, storeMetadata.tombstones, storeMetadata.tableSpace
+}
+
+// Table space to rebuild a table of tableSpace slots with for live entries.
+// A rebuild drops every tombstone, so the table is rehashed at its current
+// size while that leaves as much room again; otherwise it grows to fit
+func rebuildTarget(live int64, tableSpace int64) int64 {
+	if float64(live)/float64(tableSpace) <= sizeUpThreshold/2 {
+		return tableSpace
 	}
-	target := int(storeMetadata.tableSpace * 2)
-	strTarget := strconv.Itoa(target)
-	requestArgs := []string{"resize", strTarget}
+	target := tableSpace * 2
+	for float64(live)/float64(target) > sizeUpThreshold {
+		target *= 2
+	}
+	return target
+}
+
+// Rebuild the table with the target table space; the caller must hold
+// resizeMutex
+func rebuildTable(target int64) {
+	requestArgs := []string{"resize", strconv.Itoa(int(target))}
 	request, _ := runtime.ConstructRequest(requestArgs, true)
 	log.Println(request)
-	response := ProcessRequest(request)
+	response := resizeTable(request)
 	log.Println(response)
 }
 
+// Check size ratio against resize parameters; initiate resize if needed
+func checkResizeUp() {
+	resizeMutex.Lock()
+	defer resizeMutex.Unlock()
+	// tombstones lengthen probes as much as entries until rehashed away
+	entries, tombstones, tableSpace := tableLoad()
+	if float64(entries+tombstones)/float64(tableSpace) <= sizeUpThreshold {
+		return
+	}
+	rebuildTable(rebuildTarget(entries, tableSpace))
+}
+
 // Check size ratio against resize parameters; initiate resize if needed
 func checkResizeDown() {
-	storeMetadata.setRatio = float64(storeMetadata.entries) /
-		float64(storeMetadata.tableSpace)
-	if storeMetadata.setRatio >= sizeDownThreshold {
+	resizeMutex.Lock()
+	defer resizeMutex.Unlock()
+	entries, _, tableSpace := tableLoad()
+	if tableSpace <= minTableSpace ||
+		float64(entries)/float64(tableSpace) >= sizeDownThreshold {
 		return
 	}
-	target := int(storeMetadata.tableSpace * 2)
-	strTarget := strconv.Itoa(target)
-	requestArgs := []string{"resize", strTarget}
-	request, _ := runtime.ConstructRequest(requestArgs, true)
-	log.Println(request)
-	response := ProcessRequest(request)
-	log.Println(response)
+	rebuildTable(max(tableSpace/2, minTableSpace))
 }
 
-// Write an update to number of entries in file metadata
+// Resize up ahead of a batch of inserts so the table cannot fill mid-batch
+func reserveSpace(extra int64) {
+	// decide & resize under one lock so concurrent writers resize only once
+	resizeMutex.Lock()
+	defer resizeMutex.Unlock()
+	entries, tombstones, tableSpace := tableLoad()
+	if float64(entries+tombstones+extra)/float64(tableSpace) <= sizeUpThreshold {
+		return
+	}
+	rebuildTable(rebuildTarget(entries+extra, tableSpace))
+}
+
+// Write an update to number of entries (& so load factor) in file metadata
 func updateEntryBytes(fp *os.File, update int64, newFile bool) {
-	if !newFile {
-		storeMetadata.entries += update
+	fp.Seek(headerEntriesOffset, io.SeekStart)
+	if newFile {
+		binary.Write(fp, binary.BigEndian, int32(storeMetadata.entries))
+		return
 	}
-	fp.Seek(0, io.SeekStart)
+	storeMetadata.entries += update
 	binary.Write(fp, binary.BigEndian, int32(storeMetadata.entries))
+	writeTableBytes(fp, storeMetadata.tableSpace, storeMetadata.entries)
+}
+
+// Count a new entry written to slot in file metadata & add its key to the
+// index
+func addEntry(fp *os.File, key string, slot decodedEntry) {
+	if slot.Tombstone {
+		storeMetadata.tombstones--
+	}
+	updateEntryBytes(fp, 1, false)
+	indexInsert(key)
+}
+
+// Uncount a cleared entry in file metadata & drop its key from the indexes;
+// the caller leaves a tombstone in its slot
+func removeEntry(fp *os.File, key string) {
+	storeMetadata.tombstones++
+	updateEntryBytes(fp, -1, false)
+	indexRemove(key)
+	valueIndexRemove(key)
+}
+
+// Write the last modification stamp issued to file metadata
+func updateVersionBytes(fp *os.File) {
+	fp.Seek(headerVersionOffset, io.SeekStart)
+	binary.Write(fp, binary.BigEndian, storeMetadata.version)
+}
+
+// Write the table generation to file metadata so scan cursors outlive a
+// restart
+func updateGenerationBytes(fp *os.File, generation uint32) {
+	fp.WriteAt(binary.BigEndian.AppendUint32(nil, generation), headerGenerationOffset)
+}
+
+// Issue the next modification stamp; stamps are unique across the store
+func nextVersion(fp *os.File) uint32 {
+	storeMetadata.version++
+	updateVersionBytes(fp)
+	return storeMetadata.version
+}
+
+func stampBytes(version uint32, modified int64) []byte {
+	buf := make([]byte, entrySize-stampOffset)
+	binary.BigEndian.PutUint32(buf, version)
+	binary.BigEndian.PutUint32(buf[4:], uint32(modified))
+	return buf
+}
+
+// Write an entry record at index with a fresh modification stamp
+func writeEntry(fp *os.File, record []byte, index int64) {
+	stamp := stampBytes(nextVersion(fp), time.Now().Unix())
+	b := append(record, stamp...)
+	fp.WriteAt(b, index)
+	decoded, _ := decodeFileBytes(b)
+	valueIndexSet(decoded)
+}
+
+// Format fp as an empty table of tableSpace slots, writing the current
+// entries, modification stamp & generation to its metadata; returns the file
+// size
+func formatTable(fp *os.File, tableSpace int64) int64 {
+	fileSize := (tableSpace * entrySize) + entrySize
+	// format in case an artifact already existed
+	fp.Truncate(0)
+	fp.Truncate(fileSize)
+	updateEntryBytes(fp, storeMetadata.entries, true)
+	updateVersionBytes(fp)
+	writeTableBytes(fp, tableSpace, storeMetadata.entries)
+	updateGenerationBytes(fp, storeMetadata.generation)
+	return fileSize
+}
+
+// Write an entry with its modification stamp into the slot it resolves to
+// in a table of tableSpace slots
+func rehashEntry(fp *os.File, d decodedEntry, tableSpace int64) error {
+	index := entryIndex(hashKey(d.Key, tableSpace))
+	resolved, err := resolveEntry(index, fp, d.Key)
+	if err != nil {
+		return err
+	}
+	fp.WriteAt(d.toBytes(), resolved.Index)
+	return nil
 }
 
 func entryIndex(i int64) int64 {
@@ -118,12 +357,17 @@ func entryIndex(i int64) int64 {
 }
 
 // Implements DJB2 hashing
-func hashKey(key string, limit int64) int64 {
+func djb2(key string) uint64 {
 	var hash uint64 = 5381
 	for _, r := range key {
 		hash = ((hash << 5) + hash) + uint64(r)
 	}
-	return (int64(hash) % limit) + 1
+	return hash
+}
+
+// Hash a key to its home slot in a table of limit slots
+func hashKey(key string, limit int64) int64 {
+	return int64(djb2(key)%uint64(limit)) + 1
 }
 
 type DecodeFileError struct {
@@ -141,19 +385,29 @@ const (
 	typeString
 )
 
+// First byte of an entry marking the state of the slot
+const (
+	slotEmpty byte = iota
+	slotSet
+	slotTombstone // cleared, but keys may have probed past it
+)
+
 type decodedEntry struct {
 	IsSet     bool
+	Tombstone bool
 	Key       string
 	ValueType valueType
 	Int       int
 	Str       string
 	Index     int64
+	Version   uint32 // modification stamp of the last write
+	Modified  int64  // unix time of the last write
 }
 
-// Turn the entry back into encoded bytes
-func (d decodedEntry) toBytes() []byte {
+// Encode the key & value record of the entry without its stamp
+func (d decodedEntry) recordBytes() []byte {
 	buf := new(bytes.Buffer)
-	buf.WriteByte(1)
+	buf.WriteByte(slotSet)
 	runtime.WriteKeyBytes(buf, d.Key, true)
 	switch d.ValueType {
 	case typeInt:
@@ -164,12 +418,59 @@ func (d decodedEntry) toBytes() []byte {
 	return buf.Bytes()
 }
 
+// Turn the entry back into encoded bytes
+func (d decodedEntry) toBytes() []byte {
+	return append(d.recordBytes(), stampBytes(d.Version, d.Modified)...)
+}
+
+// Check whether the entry holds the given int or string value
+func (d decodedEntry) matches(v any) bool {
+	switch x := v.(type) {
+	case int:
+		return d.ValueType == typeInt && d.Int == x
+	case string:
+		return d.ValueType == typeString && d.Str == x
+	}
+	return false
+}
+
+// Construct a response carrying the value of the entry
+func entryResponse(
+	request runtime.Request,
+	status runtime.Status,
+	d decodedEntry,
+) runtime.Response {
+	switch d.ValueType {
+	case typeInt:
+		return runtime.ConstructResponse(request, status, d.Int)
+	case typeString:
+		return runtime.ConstructResponse(request, status, d.Str)
+	}
+	panic("Unreachable")
+}
+
+// Format the entry as a space separated key & value row
+func (d decodedEntry) itemRow() string {
+	switch d.ValueType {
+	case typeInt:
+		return fmt.Sprintf("%s %d", d.Key, d.Int)
+	case typeString:
+		return fmt.Sprintf("%s %s", d.Key, d.Str)
+	}
+	panic("Unreachable")
+}
+
 func decodeFileBytes(b []byte) (decodedEntry, error) {
-	if b[0] == 0 {
+	switch b[0] {
+	case slotEmpty:
 		return decodedEntry{IsSet: false}, nil
+	case slotTombstone:
+		return decodedEntry{IsSet: false, Tombstone: true}, nil
 	}
 	keyLen := int(b[1])
 	key := string(b[2 : 2+keyLen])
+	version := binary.BigEndian.Uint32(b[stampOffset:])
+	modified := int64(binary.BigEndian.Uint32(b[stampOffset+4:]))
 	dataType := int(b[33])
 	if dataType == 1 {
 		valLen := int(b[34])
@@ -179,6 +480,8 @@ func decodeFileBytes(b []byte) (decodedEntry, error) {
 			Key:       key,
 			ValueType: typeString,
 			Str:       val,
+			Version:   version,
+			Modified:  modified,
 		}, nil
 	} else {
 		val := int32(binary.BigEndian.Uint32(b[34:38]))
@@ -187,6 +490,8 @@ func decodeFileBytes(b []byte) (decodedEntry, error) {
 			Key:       key,
 			ValueType: typeInt,
 			Int:       int(val),
+			Version:   version,
+			Modified:  modified,
 		}, nil
 	}
 }
@@ -211,9 +516,23 @@ func readEntry(index int64, fp *os.File, debugLog bool) (decodedEntry, error) {
 	return decoded, nil
 }
 
+// Probe from index for the entry holding key. If the key is not set the
+// returned entry is the slot to insert it into: the first tombstone passed,
+// otherwise the empty slot that ended the search
 func resolveEntry(index int64, fp *os.File, key string) (decodedEntry, error) {
+	return traceEntry(index, fp, key, nil)
+}
+
+// Resolve an entry as resolveEntry, calling probe (if set) with each slot read
+func traceEntry(
+	index int64,
+	fp *os.File,
+	key string,
+	probe func(decodedEntry),
+) (decodedEntry, error) {
 	// this should not be realistically exceeded unless there is a bad failure
 	maxPermittedCollisions := storeMetadata.tableSpace / 2
+	var tombstone int64 // index of first tombstone passed
 	for range maxPermittedCollisions {
 		decoded, err := readEntry(index, fp, true)
 		if err != nil {
@@ -226,7 +545,23 @@ func resolveEntry(index int64, fp *os.File, key string) (decodedEntry, error) {
 			log.Printf("Error resolving key %s: %v\n", key, err)
 			return decodedEntry{}, DecodeFileError{errorStr: err.Error()}
 		}
-		if !decoded.IsSet || decoded.Key == key {
+		if probe != nil {
+			probe(decoded)
+		}
+		if decoded.Tombstone {
+			if tombstone == 0 {
+				tombstone = index
+			}
+			index += entrySize
+			continue
+		}
+		if !decoded.IsSet {
+			if tombstone != 0 {
+				decoded.Index = tombstone
+			}
+			return decoded, nil
+		}
+		if decoded.Key == key {
 			return decoded, nil
 		}
 		if runtime.Config.Debug {
@@ -239,22 +574,41 @@ func resolveEntry(index int64, fp *os.File, key string) (decodedEntry, error) {
 		}
 		index += entrySize
 	}
+	if tombstone != 0 {
+		return decodedEntry{IsSet: false, Tombstone: true, Index: tombstone}, nil
+	}
 	log.Printf("Error; maximum search depth exceeded at %d for %s\n", index, key)
 	return decodedEntry{}, DecodeFileError{errorStr: "Maximum search depth"}
 }
 
+// Hash a key and resolve the entry it occupies (or the free slot for it)
+func lookup(key string, fp *os.File) (decodedEntry, error) {
+	hash := hashKey(key, storeMetadata.tableSpace)
+	index := entryIndex(hash)
+	if runtime.Config.Debug {
+		log.Printf("Hash: %d, Index: %d\n", hash, index)
+	}
+	if storeMetadata.size < index {
+		return decodedEntry{}, DecodeFileError{errorStr: "Index outside of file"}
+	}
+	return resolveEntry(index, fp, key)
+}
+
 // Overwrite the data record of an entry without modifying other bits
 //
 // Assumes the key has already been checked against the file index
-func overwriteData[T types.IntOrString](index int64, fp *os.File, data T) {
-	// seek to data section of index
-	fp.Seek(index+int64(33), io.SeekStart)
+func overwriteData[T types.IntOrString](entry decodedEntry, fp *os.File, data T) {
 	buf := new(bytes.Buffer)
 	switch d := any(data).(type) {
 	case int:
 		runtime.WriteIntBytes(buf, d, true)
+		entry.ValueType, entry.Int = typeInt, d
 	case string:
 		runtime.WriteStringBytes(buf, d, true)
+		entry.ValueType, entry.Str = typeString, d
 	}
-	fp.Write(buf.Bytes())
+	buf.Write(stampBytes(nextVersion(fp), time.Now().Unix()))
+	// write from data section of index through the stamp
+	fp.WriteAt(buf.Bytes(), entry.Index+dataOffset)
+	valueIndexSet(entry)
 }
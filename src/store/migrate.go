@@ -0,0 +1,185 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+const preStampEntrySize int64 = 66 // entry width before modification stamps
+
+// Returned by offline tools for a store the server has not yet migrated
+// from pre-stamp entries
+type PreStampStoreError struct {
+	fileSize int64
+}
+
+func (e PreStampStoreError) Error() string {
+	return fmt.Sprintf(
+		"store of %d bytes has pre-stamp %d byte entries; start the server "+
+			"once to migrate it",
+		e.fileSize,
+		preStampEntrySize,
+	)
+}
+
+// Whether every slot of the file decodes when read as entries of width &
+// the set slots agree with the entries counted in the header
+func slotsMatchHeader(
+	fp *os.File,
+	header storeHeader,
+	fileSize int64,
+	width int64,
+) bool {
+	reader := bufio.NewReader(io.NewSectionReader(fp, width, fileSize-width))
+	buf := make([]byte, width)
+	var set int64
+	for range fileSize/width - 1 {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return false
+		}
+		if validateSlot(buf) != nil {
+			return false
+		}
+		if buf[0] == slotSet {
+			set++
+		}
+	}
+	return set == header.entries
+}
+
+// Work out the width of the entries in a store with a legacy header. Stores
+// from before modification stamps have narrower entries & never wrote a
+// stamp to the header; where the file size fits both widths the slots decide
+func legacyEntryWidth(
+	fp *os.File,
+	header storeHeader,
+	fileSize int64,
+) (int64, error) {
+	var widths []int64
+	for _, width := range []int64{entrySize, preStampEntrySize} {
+		if width == preStampEntrySize && header.version != 0 {
+			continue
+		}
+		if fileSize%width == 0 && fileSize >= 2*width {
+			widths = append(widths, width)
+		}
+	}
+	if len(widths) > 1 {
+		widths = slices.DeleteFunc(widths, func(width int64) bool {
+			return !slotsMatchHeader(fp, header, fileSize, width)
+		})
+	}
+	switch len(widths) {
+	case 0:
+		return 0, StoreHeaderError{
+			errorStr: fmt.Sprintf(
+				"legacy store of %d bytes is not a whole number of %d or %d "+
+					"byte entries",
+				fileSize,
+				entrySize,
+				preStampEntrySize,
+			),
+		}
+	case 1:
+		return widths[0], nil
+	}
+	return 0, StoreHeaderError{
+		errorStr: fmt.Sprintf(
+			"cannot tell whether legacy store of %d bytes has %d or %d byte "+
+				"entries",
+			fileSize,
+			entrySize,
+			preStampEntrySize,
+		),
+	}
+}
+
+// Check a store can be read with the current entry width by offline tools,
+// which leave migrating pre-stamp stores to the server
+func checkEntryWidth(fp *os.File, header storeHeader, fileSize int64) error {
+	if !header.legacy {
+		return nil
+	}
+	width, err := legacyEntryWidth(fp, header, fileSize)
+	if err != nil {
+		return err
+	}
+	if width == preStampEntrySize {
+		return PreStampStoreError{fileSize: fileSize}
+	}
+	return nil
+}
+
+// Rewrite a store of pre-stamp entries with the current entry width,
+// stamping set entries in slot order as if written when the file was last
+// modified. Slots keep their positions so every probe chain is unchanged;
+// the original is kept as the backup
+func migratePreStamp(fp *os.File, header storeHeader, fileSize int64) error {
+	if err := checkKeptFiles(runtime.Config.BackupPath); err != nil {
+		return err
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	modified := info.ModTime().Unix()
+	tableSpace := (fileSize / preStampEntrySize) - 1
+	storeMetadata = _storeMetadata{tableSpace: tableSpace, entries: header.entries}
+	temp_fp, err := os.OpenFile(runtime.Config.TempPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer temp_fp.Close()
+	formatTable(temp_fp, tableSpace)
+
+	reader := bufio.NewReader(io.NewSectionReader(
+		fp,
+		preStampEntrySize,
+		tableSpace*preStampEntrySize,
+	))
+	buf := make([]byte, preStampEntrySize)
+	for slot := int64(1); slot <= tableSpace; slot++ {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return err
+		}
+		if err := validateSlot(buf); err != nil {
+			return StoreHeaderError{
+				errorStr: fmt.Sprintf("pre-stamp slot %d: %v", slot, err),
+			}
+		}
+		if buf[0] == slotEmpty {
+			continue
+		}
+		var stamp []byte
+		if buf[0] == slotSet {
+			storeMetadata.version++
+			stamp = stampBytes(storeMetadata.version, modified)
+		} else {
+			stamp = make([]byte, entrySize-stampOffset)
+		}
+		temp_fp.WriteAt(append(slices.Clone(buf), stamp...), entryIndex(slot))
+	}
+	updateVersionBytes(temp_fp)
+	if err := temp_fp.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(runtime.Config.StorePath, runtime.Config.BackupPath); err != nil {
+		return err
+	}
+	if err := os.Rename(runtime.Config.TempPath, runtime.Config.StorePath); err != nil {
+		return err
+	}
+	log.Printf(
+		"Migrated %d pre-stamp entries to %d byte entries; original kept at %s\n",
+		header.entries,
+		entrySize,
+		runtime.Config.BackupPath,
+	)
+	return nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// Write a store as it was laid out before modification stamps: a bare
+// entry count in the header & entries without a stamp
+func writePreStampStore(t *testing.T, path string, entries ...decodedEntry) {
+	t.Helper()
+	b := make([]byte, (minTableSpace+1)*preStampEntrySize)
+	binary.BigEndian.PutUint32(b, uint32(len(entries)))
+	for _, entry := range entries {
+		slot := hashKey(entry.Key, minTableSpace)
+		for b[slot*preStampEntrySize] != slotEmpty {
+			slot = slot%minTableSpace + 1
+		}
+		// the store's copy command shadows the builtin
+		entryBytes := entry.toBytes()[:preStampEntrySize]
+		start := int(slot * preStampEntrySize)
+		b = slices.Replace(b, start, start+len(entryBytes), entryBytes...)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPreStampStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.bin")
+	runtime.UseStoreFile(path)
+	t.Cleanup(indexReset)
+	writePreStampStore(
+		t,
+		path,
+		decodedEntry{IsSet: true, Key: "a", ValueType: typeInt, Int: 1},
+		decodedEntry{IsSet: true, Key: "b", ValueType: typeString, Str: "two"},
+	)
+
+	fp, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := checkFile(fp)
+	fp.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.problems) != 1 {
+		t.Fatalf("check of pre-stamp store gave %v", c.problems)
+	}
+
+	if err := OpenStore(); err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	if _, err := os.Stat(runtime.Config.BackupPath); err != nil {
+		t.Errorf("original store not kept: %v", err)
+	}
+	if response := process(t, "load", "a"); response.GetStatus() != runtime.Ok {
+		t.Errorf("load a after migration gave %s", response.GetStatus())
+	}
+	if data := process(t, "load", "b").DataPayload(); data != "two" {
+		t.Errorf("load b after migration gave %q", data)
+	}
+	fp, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	c, err = checkFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.problems) > 0 || c.set != 2 {
+		t.Errorf("%d set after migration: %v", c.set, c.problems)
+	}
+}
+
+func TestCurrentLegacyStoreIsNotPreStamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.bin")
+	// a stampless header over current width entries
+	b := make([]byte, (minTableSpace+1)*entrySize)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fp, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	header, err := readHeader(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkEntryWidth(fp, header, int64(len(b))); err != nil {
+		t.Errorf("current width legacy store gave %v", err)
+	}
+}
+
+func TestMigrationKeepsEarlierBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.bin")
+	runtime.UseStoreFile(path)
+	t.Cleanup(indexReset)
+	writePreStampStore(
+		t,
+		path,
+		decodedEntry{IsSet: true, Key: "a", ValueType: typeInt, Int: 1},
+	)
+	if err := os.WriteFile(runtime.Config.BackupPath, []byte("earlier"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var keptErr KeptFileError
+	if err := OpenStore(); !errors.As(err, &keptErr) {
+		t.Errorf("migration over an existing backup gave %v", err)
+	}
+	if kept, _ := os.ReadFile(runtime.Config.BackupPath); string(kept) != "earlier" {
+		t.Error("earlier backup overwritten")
+	}
+}
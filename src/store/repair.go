@@ -0,0 +1,232 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// A slot that could not be decoded, kept for manual inspection
+type quarantinedSlot struct {
+	slot   int64
+	raw    []byte
+	reason error
+}
+
+type salvage struct {
+	entries     map[string]decodedEntry // last written entry for each key
+	set         int64                   // decodable set slots read
+	quarantined []quarantinedSlot
+}
+
+// Read every slot after the header regardless of the table space it claims,
+// keeping the last written entry for each key & any undecodable slots
+func salvageEntries(fp *os.File, fileSize int64) (salvage, error) {
+	s := salvage{entries: make(map[string]decodedEntry)}
+	if fileSize <= entrySize {
+		return s, nil
+	}
+	reader := bufio.NewReader(
+		io.NewSectionReader(fp, entrySize, fileSize-entrySize),
+	)
+	for slot := int64(1); ; slot++ {
+		buf := make([]byte, entrySize)
+		n, err := io.ReadFull(reader, buf)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			s.quarantined = append(s.quarantined, quarantinedSlot{
+				slot:   slot,
+				raw:    buf[:n],
+				reason: fmt.Errorf("trailing partial entry of %d bytes", n),
+			})
+			break
+		}
+		if err != nil {
+			return salvage{}, err
+		}
+		if err := validateSlot(buf); err != nil {
+			s.quarantined = append(
+				s.quarantined,
+				quarantinedSlot{slot: slot, raw: buf, reason: err},
+			)
+			continue
+		}
+		decoded, _ := decodeFileBytes(buf)
+		if !decoded.IsSet {
+			continue
+		}
+		s.set++
+		// later slots win ties; stamps are unique unless the file was damaged
+		if kept, ok := s.entries[decoded.Key]; ok && kept.Version > decoded.Version {
+			continue
+		}
+		s.entries[decoded.Key] = decoded
+	}
+	return s, nil
+}
+
+// Returned rather than overwrite a file kept by an earlier repair or
+// migration, which may be the only copy of the original store
+type KeptFileError struct {
+	path string
+}
+
+func (e KeptFileError) Error() string {
+	return fmt.Sprintf(
+		"%s already exists and may be the only copy of an earlier store; "+
+			"move it aside to keep it",
+		e.path,
+	)
+}
+
+// Check none of the files an offline rewrite keeps the original in exist
+func checkKeptFiles(paths ...string) error {
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if err == nil {
+			return KeptFileError{path: path}
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the raw bytes of each quarantined slot one after another
+func writeQuarantine(slots []quarantinedSlot) error {
+	f, err := os.Create(runtime.Config.QuarantinePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, q := range slots {
+		if _, err := f.Write(q.raw); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+// Rebuild the store file offline from every entry that can be salvaged,
+// keeping the original as a backup & undecodable slots in a quarantine file.
+// Prints a report; returns false if the store could not be rebuilt
+func RepairStore() bool {
+	err := checkKeptFiles(runtime.Config.BackupPath, runtime.Config.QuarantinePath)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	filePath := runtime.Config.StorePath
+	fp, err := os.Open(filePath)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		fmt.Println(err)
+		return false
+	}
+	fileSize := info.Size()
+	// the last stamp issued must stay ahead of every salvaged entry
+	var version, generation uint32
+	if header, err := readHeader(fp); err == nil {
+		// salvage reads current width entries; the server migrates older ones
+		var preStamp PreStampStoreError
+		if errors.As(checkEntryWidth(fp, header, fileSize), &preStamp) {
+			fp.Close()
+			fmt.Println(preStamp)
+			return false
+		}
+		version = header.version
+		// slots move, so cursors into the old table must restart
+		generation = header.generation + 1
+	}
+	s, err := salvageEntries(fp, fileSize)
+	fp.Close()
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	keys := make([]string, 0, len(s.entries))
+	for key, d := range s.entries {
+		keys = append(keys, key)
+		version = max(version, d.Version)
+	}
+	slices.Sort(keys)
+
+	// size the table as the server would after inserting every entry
+	tableSpace := minTableSpace
+	for float64(len(keys))/float64(tableSpace) > sizeUpThreshold {
+		tableSpace *= 2
+	}
+	storeMetadata = _storeMetadata{
+		tableSpace: tableSpace,
+		entries:    int64(len(keys)),
+		version:    version,
+		generation: generation,
+	}
+	temp_fp, err := os.OpenFile(runtime.Config.TempPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	defer temp_fp.Close()
+	storeMetadata.size = formatTable(temp_fp, tableSpace)
+	for _, key := range keys {
+		if err := rehashEntry(temp_fp, s.entries[key], tableSpace); err != nil {
+			fmt.Println(err)
+			return false
+		}
+	}
+	if err := temp_fp.Sync(); err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	fmt.Printf("store: %s (%d bytes)\n", filePath, fileSize)
+	fmt.Printf(
+		"salvaged %d entries from %d set slots (%d duplicates dropped)\n",
+		len(keys),
+		s.set,
+		s.set-int64(len(keys)),
+	)
+	if len(s.quarantined) > 0 {
+		if err := writeQuarantine(s.quarantined); err != nil {
+			fmt.Println(err)
+			return false
+		}
+		fmt.Printf(
+			"quarantined %d slots to %s:\n",
+			len(s.quarantined),
+			runtime.Config.QuarantinePath,
+		)
+		for _, q := range s.quarantined {
+			fmt.Printf("  slot %d: %v\n", q.slot, q.reason)
+		}
+	}
+	if err := os.Rename(filePath, runtime.Config.BackupPath); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	if err := os.Rename(runtime.Config.TempPath, filePath); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	fmt.Printf(
+		"rebuilt with table space %d; original kept at %s\n",
+		tableSpace,
+		runtime.Config.BackupPath,
+	)
+	return true
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// Indexes of the first n empty slots of the table
+func emptySlots(t *testing.T, fp *os.File, n int) []int64 {
+	t.Helper()
+	var indexes []int64
+	state := make([]byte, 1)
+	for index := entrySize; len(indexes) < n; index += entrySize {
+		if _, err := fp.ReadAt(state, index); err != nil {
+			t.Fatal(err)
+		}
+		if state[0] == slotEmpty {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+func TestRepairStore(t *testing.T) {
+	openTestStore(t)
+	process(t, "store", "a", "old")
+	process(t, "store", "b", "2")
+	process(t, "store", "c", "3")
+	pendingResizes.Wait()
+
+	fp, err := os.OpenFile(runtime.Config.StorePath, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := lookup("c", fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	free := emptySlots(t, fp, 2)
+	// a later copy of a, a set slot with no key & junk in an empty slot
+	newer := decodedEntry{
+		IsSet:     true,
+		Key:       "a",
+		ValueType: typeString,
+		Str:       "new",
+		Version:   storeMetadata.version + 1,
+	}
+	fp.WriteAt(newer.toBytes(), free[0])
+	fp.WriteAt([]byte{slotSet, 0}, c.Index)
+	fp.WriteAt([]byte{9}, free[1])
+	// quarantined slots are written in table order
+	var quarantined []byte
+	for _, index := range []int64{min(c.Index, free[1]), max(c.Index, free[1])} {
+		raw := make([]byte, entrySize)
+		fp.ReadAt(raw, index)
+		quarantined = append(quarantined, raw...)
+	}
+	fp.Close()
+	original, err := os.ReadFile(runtime.Config.StorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !RepairStore() {
+		t.Fatal("repair failed")
+	}
+	kept, err := os.ReadFile(runtime.Config.BackupPath)
+	if err != nil || !bytes.Equal(kept, original) {
+		t.Errorf("original not kept as the backup: %v", err)
+	}
+	q, err := os.ReadFile(runtime.Config.QuarantinePath)
+	if err != nil || !bytes.Equal(q, quarantined) {
+		t.Errorf("quarantine holds %d bytes; want both bad slots: %v", len(q), err)
+	}
+	fp, err = os.Open(runtime.Config.StorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err := checkFile(fp)
+	fp.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.problems) > 0 || check.set != 2 {
+		t.Errorf("%d set after repair: %v", check.set, check.problems)
+	}
+	if err := OpenStore(); err != nil {
+		t.Fatal(err)
+	}
+	if data := process(t, "load", "a").DataPayload(); data != "new" {
+		t.Errorf("repair kept a = %q; want the later copy", data)
+	}
+	if data := process(t, "load", "b").DataPayload(); data != "2" {
+		t.Errorf("b = %q after repair", data)
+	}
+	if response := process(t, "load", "c"); response.GetStatus() != runtime.NotFound {
+		t.Errorf("undecodable c loads as %v", response)
+	}
+}
+
+func TestRepairKeepsEarlierBackup(t *testing.T) {
+	openTestStore(t)
+	process(t, "store", "a", "1")
+	pendingResizes.Wait()
+	earlier := []byte("only copy of an earlier store")
+	if err := os.WriteFile(runtime.Config.BackupPath, earlier, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if RepairStore() {
+		t.Error("repair ran over an existing backup")
+	}
+	if kept, _ := os.ReadFile(runtime.Config.BackupPath); !bytes.Equal(kept, earlier) {
+		t.Error("earlier backup overwritten")
+	}
+	err := checkKeptFiles(runtime.Config.QuarantinePath, runtime.Config.BackupPath)
+	var keptErr KeptFileError
+	if !errors.As(err, &keptErr) {
+		t.Errorf("existing backup gave %v", err)
+	}
+}
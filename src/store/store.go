@@ -8,32 +8,72 @@ import (
 	"os"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/EnemigoPython/go-getit/src/runtime"
 )
 
 func OpenStore() error {
+	// a check left running against the last store would read its metadata
+	// while it is replaced
+	pendingResizes.Wait()
 	filePath := runtime.Config.StorePath
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDONLY, 0644)
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 	minSize := (minTableSpace * entrySize) + entrySize
-	entries := readMetaBytes(file, minSize)
-	info, _ := os.Stat(filePath)
-	fileSize := int64(info.Size())
-	tableSpace := (fileSize / entrySize) - 1
-	setRatio := float64(entries) / float64(tableSpace)
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+	if fileSize == 0 {
+		// new store; write empty metadata + min table space
+		file.Truncate(minSize)
+		writeTableBytes(file, minTableSpace, 0)
+		fileSize = minSize
+	}
+	header, err := readHeader(file)
+	if err != nil {
+		return err
+	}
+	if header.legacy {
+		width, err := legacyEntryWidth(file, header, fileSize)
+		if err != nil {
+			return err
+		}
+		if width == preStampEntrySize {
+			if err := migratePreStamp(file, header, fileSize); err != nil {
+				return err
+			}
+			// open the migrated file in its place
+			return OpenStore()
+		}
+		// derive table metadata from the file size once, then persist it
+		header.tableSpace = (fileSize / entrySize) - 1
+		header.loadFactor = float64(header.entries) / float64(header.tableSpace)
+		log.Printf(
+			"Migrating legacy store header: table space %d\n",
+			header.tableSpace,
+		)
+		writeTableBytes(file, header.tableSpace, header.entries)
+	}
+	if err := header.validate(fileSize); err != nil {
+		return err
+	}
 	storeMetadata = _storeMetadata{
 		size:       fileSize,
-		tableSpace: tableSpace,
-		entries:    entries,
-		setRatio:   setRatio,
+		tableSpace: header.tableSpace,
+		entries:    header.entries,
+		setRatio:   header.loadFactor,
 		minSize:    minSize,
+		version:    header.version,
+		generation: header.generation,
 	}
 	log.Printf("Using store '%s': %+v\n", filePath, storeMetadata)
-	return nil
+	return buildIndexes(file)
 }
 
 func store(request runtime.Request, fp *os.File) runtime.Response {
@@ -59,12 +99,12 @@ func store(request runtime.Request, fp *os.File) runtime.Response {
 		)
 	}
 	if !decoded.IsSet {
-		updateEntryBytes(fp, 1, false)
+		addEntry(fp, request.GetKey(), decoded)
 		code = 1
-		go checkResizeUp()
+		pendingResizes.Go(checkResizeUp)
 	}
 	index = decoded.Index
-	fp.WriteAt(request.EncodeFileBytes(), index)
+	writeEntry(fp, request.EncodeFileBytes(), index)
 	return runtime.ConstructResponse(request, runtime.Ok, code)
 }
 
@@ -121,12 +161,12 @@ func copy(request runtime.Request, fp *os.File) runtime.Response {
 		)
 	}
 	if !decodedTo.IsSet {
-		updateEntryBytes(fp, 1, false)
-		go checkResizeUp()
+		addEntry(fp, toKey, decodedTo)
+		pendingResizes.Go(checkResizeUp)
 	}
 	toIndex = decodedTo.Index
 	decodedFrom.Key = toKey
-	fp.WriteAt(decodedFrom.toBytes(), toIndex)
+	writeEntry(fp, decodedFrom.recordBytes(), toIndex)
 	switch decodedFrom.ValueType {
 	case typeInt:
 		return runtime.ConstructResponse(request, runtime.Ok, decodedFrom.Int)
@@ -170,7 +210,7 @@ func arithmeticOperation(
 		if err != nil {
 			return runtime.ConstructResponse(
 				request,
-				runtime.ServerError,
+				runtime.InvalidRequest,
 				err.Error(),
 			)
 		}
@@ -181,14 +221,20 @@ func arithmeticOperation(
 				"Operation causes overflow or underflow",
 			)
 		}
-		overwriteData(index, fp, calculatedVal)
+		overwriteData(decoded, fp, calculatedVal)
 		return runtime.ConstructResponse(request, runtime.Ok, calculatedVal)
 	case typeString:
 		var errorMessage string
-		if a == runtime.A_Add {
+		switch a {
+		case runtime.A_Add:
 			errorMessage = "Cannot add to string"
-		} else {
+		case runtime.A_Sub:
 			errorMessage = "Cannot subtract from string"
+		default:
+			errorMessage = fmt.Sprintf(
+				"Cannot %s string",
+				request.GetAction().ToLower(),
+			)
 		}
 		return runtime.ConstructResponse(
 			request,
@@ -199,12 +245,411 @@ func arithmeticOperation(
 	panic("Unreachable")
 }
 
-func add(request runtime.Request, fp *os.File) runtime.Response {
-	return arithmeticOperation(request, fp, runtime.A_Add)
+func arithmetic(request runtime.Request, fp *os.File) runtime.Response {
+	a, _ := request.GetAction().ArithmeticType()
+	return arithmeticOperation(request, fp, a)
+}
+
+// Add to the value of a key, creating it at 0 if not set
+func incr(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if decoded.IsSet {
+		return arithmeticOperation(request, fp, runtime.A_Add)
+	}
+	calculatedVal, _ := request.ArithmeticOperation(runtime.A_Add, 0)
+	addEntry(fp, request.GetKey(), decoded)
+	pendingResizes.Go(checkResizeUp)
+	entry := decodedEntry{
+		IsSet:     true,
+		Key:       request.GetKey(),
+		ValueType: typeInt,
+		Int:       calculatedVal,
+	}
+	writeEntry(fp, entry.recordBytes(), decoded.Index)
+	return runtime.ConstructResponse(request, runtime.Ok, calculatedVal)
+}
+
+// Store the new value only if the current value matches the expected one
+func cas(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if !decoded.IsSet {
+		return runtime.ConstructResponse(request, runtime.NotFound, 0)
+	}
+	if !decoded.matches(request.GetArgs()[0]) {
+		return runtime.ConstructResponse(request, runtime.ConditionFailed, 0)
+	}
+	writeEntry(fp, request.EncodeFileBytes(), decoded.Index)
+	return runtime.ConstructResponse(request, runtime.Ok, 1)
+}
+
+// Store only if the key is absent
+func setNX(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if decoded.IsSet {
+		return runtime.ConstructResponse(request, runtime.ConditionFailed, 0)
+	}
+	addEntry(fp, request.GetKey(), decoded)
+	pendingResizes.Go(checkResizeUp)
+	writeEntry(fp, request.EncodeFileBytes(), decoded.Index)
+	return runtime.ConstructResponse(request, runtime.Ok, 1)
+}
+
+// Store only if the key is present
+func setXX(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if !decoded.IsSet {
+		return runtime.ConstructResponse(request, runtime.NotFound, 0)
+	}
+	writeEntry(fp, request.EncodeFileBytes(), decoded.Index)
+	return runtime.ConstructResponse(request, runtime.Ok, 1)
+}
+
+// Store the new value and return the old one
+func getSet(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if !decoded.IsSet {
+		addEntry(fp, request.GetKey(), decoded)
+		pendingResizes.Go(checkResizeUp)
+	}
+	writeEntry(fp, request.EncodeFileBytes(), decoded.Index)
+	if !decoded.IsSet {
+		return runtime.ConstructResponse(request, runtime.NotFound, 0)
+	}
+	return entryResponse(request, runtime.Ok, decoded)
+}
+
+// Write alternating keys & typed values, returning how many keys were new
+func setPairs(fp *os.File, args []any) (int, error) {
+	var created int
+	for i := 0; i < len(args); i += 2 {
+		key := args[i].(string)
+		decoded, err := lookup(key, fp)
+		if err != nil {
+			return created, err
+		}
+		if !decoded.IsSet {
+			addEntry(fp, key, decoded)
+			created++
+		}
+		entry := decodedEntry{IsSet: true, Key: key}
+		switch v := args[i+1].(type) {
+		case int:
+			entry.ValueType = typeInt
+			entry.Int = v
+		case string:
+			entry.ValueType = typeString
+			entry.Str = v
+		}
+		writeEntry(fp, entry.recordBytes(), decoded.Index)
+	}
+	return created, nil
+}
+
+func mset(request runtime.Request, fp *os.File) runtime.Response {
+	created, err := setPairs(fp, request.GetArgs())
+	if created > 0 {
+		pendingResizes.Go(checkResizeUp)
+	}
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	return runtime.ConstructResponse(request, runtime.Ok, created)
+}
+
+// Write one batch of a bulk load. Space for the batch is reserved before
+// the lock is taken, so unlike mset it leaves no resize check behind; the
+// table grows ahead of each batch, doubling as the load needs
+func bulkSet(request runtime.Request, fp *os.File) runtime.Response {
+	created, err := setPairs(fp, request.GetArgs())
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	return runtime.ConstructResponse(request, runtime.Ok, created)
+}
+
+// Move an entry to a new key, keeping its value & last modified time
+func renameOperation(
+	request runtime.Request,
+	fp *os.File,
+	overwrite bool,
+) runtime.Response {
+	from, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if !from.IsSet {
+		return runtime.ConstructResponse(request, runtime.NotFound, 0)
+	}
+	toKey, _ := request.GetStringData()
+	if toKey == from.Key {
+		return runtime.ConstructResponse(request, runtime.Ok, 1)
+	}
+	to, err := lookup(toKey, fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if to.IsSet && !overwrite {
+		return runtime.ConstructResponse(request, runtime.ConditionFailed, 0)
+	}
+	if !to.IsSet {
+		addEntry(fp, toKey, to)
+	}
+	moved := from
+	moved.Key = toKey
+	moved.Index = to.Index
+	moved.Version = nextVersion(fp)
+	fp.WriteAt(moved.toBytes(), moved.Index)
+	valueIndexSet(moved)
+
+	// leave a tombstone so keys probed past the old slot stay reachable
+	fp.WriteAt([]byte{slotTombstone}, from.Index)
+	removeEntry(fp, from.Key)
+	return runtime.ConstructResponse(request, runtime.Ok, 1)
+}
+
+func rename(request runtime.Request, fp *os.File) runtime.Response {
+	return renameOperation(request, fp, true)
+}
+
+func renameNX(request runtime.Request, fp *os.File) runtime.Response {
+	return renameOperation(request, fp, false)
+}
+
+// Resolve a key that must hold a string for a string operation
+func stringEntry(
+	request runtime.Request,
+	fp *os.File,
+) (decodedEntry, runtime.Response) {
+	decoded, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return decoded, runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if !decoded.IsSet {
+		return decoded, runtime.ConstructResponse(request, runtime.NotFound, 0)
+	}
+	if decoded.ValueType != typeString {
+		return decoded, runtime.ConstructResponse(
+			request,
+			runtime.InvalidRequest,
+			fmt.Sprintf("Cannot %s int", request.GetAction().ToLower()),
+		)
+	}
+	return decoded, nil
+}
+
+// Append to a string; returns the new length
+func appendOperation(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, response := stringEntry(request, fp)
+	if response != nil {
+		return response
+	}
+	suffix, _ := request.GetStringData()
+	updated := decoded.Str + suffix
+	if len(updated) > runtime.MaxStringLen {
+		return runtime.ConstructResponse(
+			request,
+			runtime.InvalidRequest,
+			fmt.Sprintf("String would exceed %d characters", runtime.MaxStringLen),
+		)
+	}
+	overwriteData(decoded, fp, updated)
+	return runtime.ConstructResponse(request, runtime.Ok, len(updated))
+}
+
+func strLen(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, response := stringEntry(request, fp)
+	if response != nil {
+		return response
+	}
+	return runtime.ConstructResponse(request, runtime.Ok, len(decoded.Str))
 }
 
-func sub(request runtime.Request, fp *os.File) runtime.Response {
-	return arithmeticOperation(request, fp, runtime.A_Sub)
+// Substring between inclusive offsets; negative offsets count from the end
+func getRange(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, response := stringEntry(request, fp)
+	if response != nil {
+		return response
+	}
+	start, _ := request.GetIntData()
+	end := request.GetArgs()[0].(int)
+	length := len(decoded.Str)
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if end < 0 {
+		end = length + end
+	}
+	end = min(end, length-1)
+	if start > end {
+		return runtime.ConstructResponse(request, runtime.Ok, "")
+	}
+	return runtime.ConstructResponse(
+		request,
+		runtime.Ok,
+		decoded.Str[start:end+1],
+	)
+}
+
+// Overwrite part of a string from an offset; returns the new length
+func setRange(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, response := stringEntry(request, fp)
+	if response != nil {
+		return response
+	}
+	value, _ := request.GetStringData()
+	offset := request.GetArgs()[0].(int)
+	if offset > len(decoded.Str) {
+		return runtime.ConstructResponse(
+			request,
+			runtime.InvalidRequest,
+			fmt.Sprintf("Offset beyond end of string (length %d)", len(decoded.Str)),
+		)
+	}
+	updated := decoded.Str[:offset] + value
+	if offset+len(value) < len(decoded.Str) {
+		updated += decoded.Str[offset+len(value):]
+	}
+	if len(updated) > runtime.MaxStringLen {
+		return runtime.ConstructResponse(
+			request,
+			runtime.InvalidRequest,
+			fmt.Sprintf("String would exceed %d characters", runtime.MaxStringLen),
+		)
+	}
+	overwriteData(decoded, fp, updated)
+	return runtime.ConstructResponse(request, runtime.Ok, len(updated))
+}
+
+// Count a call against a fixed window rate limit; returns the remaining
+// quota in the window if the call is allowed, or fails the condition if not.
+//
+// The counter is a plain int entry; its last modified time tells whether
+// it was counted in the current window or should start again from 0
+func limit(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if decoded.IsSet && decoded.ValueType != typeInt {
+		return runtime.ConstructResponse(
+			request,
+			runtime.InvalidRequest,
+			"Cannot limit string",
+		)
+	}
+	maxCalls, _ := request.GetIntData()
+	window := int64(request.GetArgs()[0].(int))
+	now := time.Now().Unix()
+	var calls int
+	if decoded.IsSet && decoded.Modified/window == now/window {
+		calls = decoded.Int
+	}
+	if calls >= maxCalls {
+		// told apart from the last allowed call, which leaves 0
+		return runtime.ConstructResponse(request, runtime.ConditionFailed, "denied")
+	}
+	calls++
+	if decoded.IsSet {
+		overwriteData(decoded, fp, calls)
+	} else {
+		addEntry(fp, request.GetKey(), decoded)
+		pendingResizes.Go(checkResizeUp)
+		entry := decodedEntry{
+			IsSet:     true,
+			Key:       request.GetKey(),
+			ValueType: typeInt,
+			Int:       calls,
+		}
+		writeEntry(fp, entry.recordBytes(), decoded.Index)
+	}
+	return runtime.ConstructResponse(request, runtime.Ok, maxCalls-calls)
+}
+
+// Add to the value of a key, keeping the result within min & max
+func addClamp(request runtime.Request, fp *os.File) runtime.Response {
+	decoded, err := lookup(request.GetKey(), fp)
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	if !decoded.IsSet {
+		return runtime.ConstructResponse(request, runtime.NotFound, 0)
+	}
+	if decoded.ValueType != typeInt {
+		return runtime.ConstructResponse(
+			request,
+			runtime.InvalidRequest,
+			"Cannot add to string",
+		)
+	}
+	delta, _ := request.GetIntData()
+	args := request.GetArgs()
+	lower, upper := args[0].(int), args[1].(int)
+	calculatedVal := min(max(decoded.Int+delta, lower), upper)
+	overwriteData(decoded, fp, calculatedVal)
+	return runtime.ConstructResponse(request, runtime.Ok, calculatedVal)
 }
 
 func load(request runtime.Request, fp *os.File) runtime.Response {
@@ -261,13 +706,12 @@ func clear(request runtime.Request, fp *os.File) runtime.Response {
 			err.Error(),
 		)
 	}
-	index = decoded.Index
-	fp.Seek(index, io.SeekStart)
-	fp.Write([]byte{0}) // unset header byte
 	if decoded.IsSet {
+		// leave a tombstone so keys probed past this slot stay reachable
+		fp.WriteAt([]byte{slotTombstone}, decoded.Index)
 		// if the entry was previously set decrement the entries counter
-		updateEntryBytes(fp, -1, false)
-		go checkResizeDown()
+		removeEntry(fp, request.GetKey())
+		pendingResizes.Go(checkResizeDown)
 		return runtime.ConstructResponse(request, runtime.Ok, 0)
 	}
 	return runtime.ConstructResponse(request, runtime.NotFound, 0)
@@ -277,14 +721,25 @@ func clearAll(request runtime.Request, fp *os.File) runtime.Response {
 	fp.Truncate(storeMetadata.minSize)
 	storeMetadata.size = storeMetadata.minSize
 	storeMetadata.tableSpace = minTableSpace
+	storeMetadata.tombstones = 0
+	storeMetadata.generation++
+	updateGenerationBytes(fp, storeMetadata.generation)
 	// format remaining table space
 	formatLen := storeMetadata.minSize - entrySize
 	buf := make([]byte, formatLen)
 	fp.WriteAt(buf, entrySize)
 	updateEntryBytes(fp, -storeMetadata.entries, false)
+	indexReset()
+	valueIndexReset()
 	return runtime.ConstructResponse(request, runtime.Ok, 0)
 }
 
+// Check the entry key against the optional pattern of a stream request
+func matchesPattern(request runtime.Request, decoded decodedEntry) bool {
+	pattern := request.GetKey()
+	return pattern == "" || runtime.MatchPattern(pattern, decoded.Key)
+}
+
 func keys(request runtime.Request, fp *os.File, i int) runtime.Response {
 	index := entryIndex(int64(i + 1))
 	if storeMetadata.size < index {
@@ -298,7 +753,7 @@ func keys(request runtime.Request, fp *os.File, i int) runtime.Response {
 			err.Error(),
 		)
 	}
-	if decoded.IsSet {
+	if decoded.IsSet && matchesPattern(request, decoded) {
 		return runtime.ConstructResponse(request, runtime.Ok, decoded.Key)
 	}
 	return runtime.ConstructResponse(request, runtime.NotFound, 0)
@@ -317,7 +772,7 @@ func values(request runtime.Request, fp *os.File, i int) runtime.Response {
 			err.Error(),
 		)
 	}
-	if decoded.IsSet {
+	if decoded.IsSet && matchesPattern(request, decoded) {
 		switch decoded.ValueType {
 		case typeInt:
 			return runtime.ConstructResponse(request, runtime.Ok, decoded.Int)
@@ -341,20 +796,77 @@ func items(request runtime.Request, fp *os.File, i int) runtime.Response {
 			err.Error(),
 		)
 	}
-	if decoded.IsSet {
-		var itemRow string
-		switch decoded.ValueType {
-		case typeInt:
-			itemRow = fmt.Sprintf("%s %d", decoded.Key, decoded.Int)
-		case typeString:
-			itemRow = fmt.Sprintf("%s %s", decoded.Key, decoded.Str)
-		}
-		return runtime.ConstructResponse(request, runtime.Ok, itemRow)
+	if decoded.IsSet && matchesPattern(request, decoded) {
+		return runtime.ConstructResponse(request, runtime.Ok, decoded.itemRow())
 	}
 	return runtime.ConstructResponse(request, runtime.NotFound, 0)
 }
 
+// Create a value index & populate it from the current entries
+func createIndex(request runtime.Request, fp *os.File) runtime.Response {
+	name := request.GetKey()
+	if _, ok := valueIndexes[name]; ok {
+		return runtime.ConstructResponse(
+			request,
+			runtime.InvalidRequest,
+			fmt.Sprintf("Index '%s' already exists", name),
+		)
+	}
+	prefix, _ := request.GetStringData()
+	v := newValueIndex(prefix)
+	for index := entrySize; index < storeMetadata.size; index += entrySize {
+		decoded, err := readEntry(index, fp, false)
+		if err != nil {
+			return runtime.ConstructResponse(
+				request,
+				runtime.ServerError,
+				err.Error(),
+			)
+		}
+		if decoded.IsSet {
+			v.set(decoded)
+		}
+	}
+	valueIndexes[name] = v
+	if err := saveValueIndexes(); err != nil {
+		delete(valueIndexes, name)
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	return runtime.ConstructResponse(request, runtime.Ok, len(v.values))
+}
+
+func dropIndex(request runtime.Request, fp *os.File) runtime.Response {
+	name := request.GetKey()
+	v, ok := valueIndexes[name]
+	if !ok {
+		return runtime.ConstructResponse(request, runtime.NotFound, 0)
+	}
+	delete(valueIndexes, name)
+	if err := saveValueIndexes(); err != nil {
+		valueIndexes[name] = v
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	return runtime.ConstructResponse(request, runtime.Ok, 0)
+}
+
 func resize(request runtime.Request) runtime.Response {
+	resizeMutex.Lock()
+	defer resizeMutex.Unlock()
+	return resizeTable(request)
+}
+
+// Rebuild the table into the temp file & swap it in; the caller must hold
+// resizeMutex
+func resizeTable(request runtime.Request) runtime.Response {
+	start := time.Now()
 	// we will free the read pointer manually
 	fp, err := getReadPointer()
 	if err != nil {
@@ -364,6 +876,14 @@ func resize(request runtime.Request) runtime.Response {
 			err.Error(),
 		)
 	}
+	readLocked := true
+	defer func() {
+		// writers would wait forever on a failed resize otherwise
+		if readLocked {
+			fp.Close()
+			freeRLock()
+		}
+	}()
 	newTableSpace, err := request.GetIntData()
 	if err != nil {
 		return runtime.ConstructResponse(
@@ -383,7 +903,7 @@ func resize(request runtime.Request) runtime.Response {
 	}
 	// create new file for overwrite
 	filePath := runtime.Config.TempPath
-	temp_fp, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDONLY, 0644)
+	temp_fp, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return runtime.ConstructResponse(
 			request,
@@ -392,14 +912,7 @@ func resize(request runtime.Request) runtime.Response {
 		)
 	}
 	defer temp_fp.Close()
-	newFileSize := (int64(newTableSpace) * entrySize) + entrySize
-
-	// format in case an artifact already existed
-	temp_fp.Truncate(0)
-	temp_fp.Truncate(newFileSize)
-
-	// write current entries to new file metadata
-	updateEntryBytes(temp_fp, storeMetadata.entries, true)
+	newFileSize := formatTable(temp_fp, int64(newTableSpace))
 
 	nextIndex := make(chan int64)
 	resChannel := make(chan runtime.Response, 1)
@@ -427,30 +940,25 @@ func resize(request runtime.Request) runtime.Response {
 				if !decodedEntry.IsSet {
 					continue
 				}
-				// rehash key
-				newHash := hashKey(decodedEntry.Key, int64(newTableSpace))
-				newIndex := entryIndex(newHash)
 				if runtime.Config.Debug {
 					oldHash := hashKey(
 						decodedEntry.Key,
 						storeMetadata.tableSpace,
 					)
+					newHash := hashKey(decodedEntry.Key, int64(newTableSpace))
 					log.Printf(
 						"Key '%s' (hash %d, index %d)->(hash %d, index %d)",
 						decodedEntry.Key,
 						oldHash,
 						index,
 						newHash,
-						newIndex,
+						entryIndex(newHash),
 					)
 				}
 				// lock temp file & write to new index
 				tempMutex.Lock()
-				newDecodedEntry, err := resolveEntry(
-					newIndex,
-					temp_fp,
-					decodedEntry.Key,
-				)
+				err = rehashEntry(temp_fp, decodedEntry, int64(newTableSpace))
+				tempMutex.Unlock()
 				if err != nil {
 					resChannel <- runtime.ConstructResponse(
 						request,
@@ -458,9 +966,6 @@ func resize(request runtime.Request) runtime.Response {
 						err.Error(),
 					)
 				}
-				newIndex = newDecodedEntry.Index
-				temp_fp.WriteAt(decodedEntry.toBytes(), newIndex)
-				tempMutex.Unlock()
 			}
 		})
 	}
@@ -472,10 +977,13 @@ func resize(request runtime.Request) runtime.Response {
 	response := <-resChannel
 	// if no errors, replace with new file
 	if response.GetStatus() == runtime.Ok {
+		// slot positions change, so cursors into the old table must restart
+		updateGenerationBytes(temp_fp, storeMetadata.generation+1)
 		// close all file pointers & acquire write lock to rename
 		temp_fp.Close()
 		fp.Close()
 		freeRLock()
+		readLocked = false
 		acquireLock()
 		defer freeLock()
 		err = os.Rename(runtime.Config.TempPath, runtime.Config.StorePath)
@@ -488,7 +996,11 @@ func resize(request runtime.Request) runtime.Response {
 		}
 		storeMetadata.size = newFileSize
 		storeMetadata.tableSpace = int64(newTableSpace)
+		storeMetadata.tombstones = 0
+		storeMetadata.generation++
 		storeMetadata.setRatio = newSetRatio
+		storeMetadata.lastResize = start
+		storeMetadata.lastResizeDuration = time.Since(start)
 	}
 	return response
 }
@@ -553,6 +1065,9 @@ func writeOperation(
 	f func(runtime.Request, *os.File) runtime.Response,
 	request runtime.Request,
 ) runtime.Response {
+	// make room for inserts up front; a resize can't start while the lock
+	// is held, so pipelined writes could otherwise fill the table first
+	reserveSpace(insertCount(request))
 	fp, err := getReadWritePointer()
 	if err != nil {
 		return runtime.ConstructResponse(
@@ -572,16 +1087,58 @@ func ProcessRequest(request runtime.Request) runtime.Response {
 		return writeOperation(store, request)
 	case runtime.Copy:
 		return writeOperation(copy, request)
-	case runtime.Add:
-		return writeOperation(add, request)
-	case runtime.Sub:
-		return writeOperation(sub, request)
+	case
+		runtime.Add,
+		runtime.Sub,
+		runtime.Mul,
+		runtime.Div,
+		runtime.Mod,
+		runtime.SetMax,
+		runtime.SetMin,
+		runtime.And,
+		runtime.Or,
+		runtime.Xor:
+		return writeOperation(arithmetic, request)
+	case runtime.Incr:
+		return writeOperation(incr, request)
+	case runtime.Limit:
+		return writeOperation(limit, request)
+	case runtime.AddClamp:
+		return writeOperation(addClamp, request)
+	case runtime.Cas:
+		return writeOperation(cas, request)
+	case runtime.SetNX:
+		return writeOperation(setNX, request)
+	case runtime.SetXX:
+		return writeOperation(setXX, request)
+	case runtime.GetSet:
+		return writeOperation(getSet, request)
+	case runtime.Append:
+		return writeOperation(appendOperation, request)
+	case runtime.StrLen:
+		return readOperation(strLen, request)
+	case runtime.GetRange:
+		return readOperation(getRange, request)
+	case runtime.SetRange:
+		return writeOperation(setRange, request)
+	case runtime.Rename:
+		return writeOperation(rename, request)
+	case runtime.RenameNX:
+		return writeOperation(renameNX, request)
+	case runtime.MSet:
+		return writeOperation(mset, request)
+	case runtime.BulkSet:
+		return writeOperation(bulkSet, request)
 	case runtime.Load:
 		return readOperation(load, request)
 	case runtime.Clear:
 		return writeOperation(clear, request)
 	case runtime.ClearAll:
 		return writeOperation(clearAll, request)
+	case runtime.CreateIndex:
+		return writeOperation(createIndex, request)
+	case runtime.DropIndex:
+		return writeOperation(dropIndex, request)
 	case runtime.Resize:
 		// uses a temp file so no need to block readers
 		return resize(request)
@@ -597,6 +1154,172 @@ func ProcessRequest(request runtime.Request) runtime.Response {
 	panic("Unreachable")
 }
 
+// Handler for actions that may be queued in a transaction
+func transactionHandler(
+	a runtime.Action,
+) func(runtime.Request, *os.File) runtime.Response {
+	switch a {
+	case runtime.Store:
+		return store
+	case runtime.Copy:
+		return copy
+	case
+		runtime.Add,
+		runtime.Sub,
+		runtime.Mul,
+		runtime.Div,
+		runtime.Mod,
+		runtime.SetMax,
+		runtime.SetMin,
+		runtime.And,
+		runtime.Or,
+		runtime.Xor:
+		return arithmetic
+	case runtime.Incr:
+		return incr
+	case runtime.Limit:
+		return limit
+	case runtime.AddClamp:
+		return addClamp
+	case runtime.Load:
+		return load
+	case runtime.Clear:
+		return clear
+	case runtime.Cas:
+		return cas
+	case runtime.SetNX:
+		return setNX
+	case runtime.SetXX:
+		return setXX
+	case runtime.GetSet:
+		return getSet
+	case runtime.MSet:
+		return mset
+	case runtime.Rename:
+		return rename
+	case runtime.RenameNX:
+		return renameNX
+	case runtime.Append:
+		return appendOperation
+	case runtime.StrLen:
+		return strLen
+	case runtime.GetRange:
+		return getRange
+	case runtime.SetRange:
+		return setRange
+	default:
+		return nil
+	}
+}
+
+// Most keys a write request can add to the table
+func insertCount(request runtime.Request) int64 {
+	switch request.GetAction() {
+	case runtime.MSet, runtime.BulkSet:
+		return int64(len(request.GetArgs()) / 2)
+	case runtime.Load, runtime.StrLen, runtime.GetRange, runtime.Clear:
+		return 0
+	}
+	return 1
+}
+
+// Check whether a request can be queued in a transaction
+func Queueable(request runtime.Request) bool {
+	return transactionHandler(request.GetAction()) != nil
+}
+
+// Record the current modification stamp of each watched key (0 if unset)
+func Watch(request runtime.Request, watched map[string]uint32) runtime.Response {
+	fp, err := getReadPointer()
+	if err != nil {
+		return runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+	}
+	defer fp.Close()
+	defer freeRLock()
+	for _, arg := range request.GetArgs() {
+		key := arg.(string)
+		decoded, err := lookup(key, fp)
+		if err != nil {
+			return runtime.ConstructResponse(
+				request,
+				runtime.ServerError,
+				err.Error(),
+			)
+		}
+		watched[key] = decoded.Version
+	}
+	return runtime.ConstructResponse(request, runtime.Ok, len(watched))
+}
+
+// Apply queued requests under a single write lock, aborting if any watched
+// key has been modified since it was watched
+func ProcessTransaction(
+	request runtime.Request,
+	queued []runtime.Request,
+	watched map[string]uint32,
+) []runtime.Response {
+	// every queued request runs under one lock, so make room for all of
+	// their inserts before taking it
+	var inserts int64
+	for _, q := range queued {
+		inserts += insertCount(q)
+	}
+	reserveSpace(inserts)
+	fp, err := getReadWritePointer()
+	if err != nil {
+		return []runtime.Response{runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)}
+	}
+	defer fp.Close()
+	defer freeLock()
+	for key, version := range watched {
+		decoded, err := lookup(key, fp)
+		if err != nil {
+			return []runtime.Response{runtime.ConstructResponse(
+				request,
+				runtime.ServerError,
+				err.Error(),
+			)}
+		}
+		if decoded.Version != version {
+			if runtime.Config.Debug {
+				log.Printf("Watched key %s modified; aborting\n", key)
+			}
+			return []runtime.Response{
+				runtime.ConstructResponse(request, runtime.Aborted, 0),
+			}
+		}
+	}
+	responses := make([]runtime.Response, 0, len(queued)+1)
+	for _, q := range queued {
+		f := transactionHandler(q.GetAction())
+		response := f(q, fp)
+		// an error would end the stream of exec's results, so report the
+		// command's failure in a status that doesn't
+		switch response.GetStatus() {
+		case runtime.InvalidRequest, runtime.ServerError:
+			response = runtime.ConstructResponse(
+				q,
+				runtime.Failed,
+				response.ErrorMessage(),
+			)
+		}
+		// results are streamed back as the response to exec
+		responses = append(responses, response.WithId(request.GetId()))
+	}
+	return append(
+		responses,
+		runtime.ConstructResponse(request, runtime.StreamDone, 0),
+	)
+}
+
 func streamReadOperation(
 	f func(runtime.Request, *os.File, int) runtime.Response,
 	request runtime.Request,
@@ -655,6 +1378,223 @@ func streamReadOperation(
 	}()
 }
 
+// Load each requested key in order under a single read lock
+func mgetOperation(request runtime.Request, out chan<- runtime.Response) {
+	defer close(out)
+	fp, err := getReadPointer()
+	if err != nil {
+		out <- runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+		return
+	}
+	defer fp.Close()
+	defer freeRLock()
+	for _, arg := range request.GetArgs() {
+		decoded, err := lookup(arg.(string), fp)
+		if err != nil {
+			out <- runtime.ConstructResponse(
+				request,
+				runtime.ServerError,
+				err.Error(),
+			)
+			return
+		}
+		// missing keys are sent as not found to keep the order
+		if !decoded.IsSet {
+			out <- runtime.ConstructResponse(request, runtime.NotFound, 0)
+			continue
+		}
+		out <- entryResponse(request, runtime.Ok, decoded)
+	}
+	out <- runtime.ConstructResponse(request, runtime.StreamDone, 0)
+}
+
+// Stream keys from the ordered index instead of scanning the table
+func indexScanOperation(request runtime.Request, out chan<- runtime.Response) {
+	defer close(out)
+	mutex.RLock()
+	var keys []string
+	switch request.GetAction() {
+	case runtime.ScanPrefix:
+		keys = indexPrefix(request.GetKey())
+	case runtime.ScanRange:
+		end, _ := request.GetStringData()
+		var limit int
+		if args := request.GetArgs(); len(args) > 0 {
+			limit = args[0].(int)
+		}
+		keys = indexRange(request.GetKey(), end, limit)
+	}
+	freeRLock()
+	for _, key := range keys {
+		out <- runtime.ConstructResponse(request, runtime.Ok, key)
+	}
+	out <- runtime.ConstructResponse(request, runtime.StreamDone, 0)
+}
+
+// Stream every entry in key order as a JSON line under a single read lock
+func exportOperation(request runtime.Request, out chan<- runtime.Response) {
+	defer close(out)
+	fp, err := getReadPointer()
+	if err != nil {
+		out <- runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+		return
+	}
+	keys := indexKeys()
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		decoded, err := lookup(key, fp)
+		if err != nil {
+			fp.Close()
+			freeRLock()
+			out <- runtime.ConstructResponse(
+				request,
+				runtime.ServerError,
+				err.Error(),
+			)
+			return
+		}
+		switch decoded.ValueType {
+		case typeInt:
+			lines = append(lines, runtime.EncodeRecord(key, decoded.Int))
+		case typeString:
+			lines = append(lines, runtime.EncodeRecord(key, decoded.Str))
+		}
+	}
+	fp.Close()
+	freeRLock()
+	for _, line := range lines {
+		out <- runtime.ConstructResponse(request, runtime.Ok, line)
+	}
+	out <- runtime.ConstructResponse(request, runtime.StreamDone, 0)
+}
+
+// Split a scan cursor into its table generation & next slot
+func parseCursor(cursor int) (uint32, int64) {
+	generation := uint32(cursor >> cursorSlotBits)
+	slot := int64(cursor & (1<<cursorSlotBits - 1))
+	return generation, slot
+}
+
+// Returned when a scan reaches a slot past those a cursor can hold
+type CursorRangeError struct {
+	slot int64
+}
+
+func (e CursorRangeError) Error() string {
+	return fmt.Sprintf(
+		"slot %d is past the %d slots a scan cursor can resume from",
+		e.slot,
+		1<<cursorSlotBits-1,
+	)
+}
+
+func makeCursor(generation uint32, slot int64) (int, error) {
+	if slot >= 1<<cursorSlotBits {
+		// would spill into the generation bits
+		return 0, CursorRangeError{slot: slot}
+	}
+	return int(generation%cursorGenerations)<<cursorSlotBits | int(slot), nil
+}
+
+// Stream a batch of entries from the cursor position, starting with the
+// cursor to resume from (0 once the whole table has been scanned).
+//
+// A resize invalidates slot positions, so a cursor from an earlier table
+// generation restarts at the first slot; entries present for the whole
+// iteration are always returned, but may be returned more than once
+func scanOperation(request runtime.Request, out chan<- runtime.Response) {
+	defer close(out)
+	fp, err := getReadPointer()
+	if err != nil {
+		out <- runtime.ConstructResponse(
+			request,
+			runtime.ServerError,
+			err.Error(),
+		)
+		return
+	}
+	defer fp.Close()
+	defer freeRLock()
+	cursor, _ := request.GetIntData()
+	count := request.GetArgs()[0].(int)
+	generation, slot := parseCursor(cursor)
+	if slot == 0 || generation != storeMetadata.generation%cursorGenerations {
+		if runtime.Config.Debug && slot != 0 {
+			log.Printf("Cursor %d from old table generation; restarting\n", cursor)
+		}
+		slot = 1
+	}
+	var batch []decodedEntry
+	for ; slot <= storeMetadata.tableSpace && len(batch) < count; slot++ {
+		decoded, err := readEntry(entryIndex(slot), fp, false)
+		if err != nil {
+			out <- runtime.ConstructResponse(
+				request,
+				runtime.ServerError,
+				err.Error(),
+			)
+			return
+		}
+		if decoded.IsSet && matchesPattern(request, decoded) {
+			batch = append(batch, decoded)
+		}
+	}
+	next := 0
+	if slot <= storeMetadata.tableSpace {
+		next, err = makeCursor(storeMetadata.generation, slot)
+		if err != nil {
+			out <- runtime.ConstructResponse(
+				request,
+				runtime.ServerError,
+				err.Error(),
+			)
+			return
+		}
+	}
+	out <- runtime.ConstructResponse(request, runtime.Ok, next)
+	for _, decoded := range batch {
+		out <- runtime.ConstructResponse(request, runtime.Ok, decoded.itemRow())
+	}
+	out <- runtime.ConstructResponse(request, runtime.StreamDone, 0)
+}
+
+// Stream keys holding a value using the value indexes
+func findByValueOperation(request runtime.Request, out chan<- runtime.Response) {
+	defer close(out)
+	mutex.RLock()
+	name := request.GetKey()
+	_, named := valueIndexes[name]
+	if len(valueIndexes) == 0 || (name != "" && !named) {
+		freeRLock()
+		out <- runtime.ConstructResponse(
+			request,
+			runtime.InvalidRequest,
+			"No value index to search; create one with createindex",
+		)
+		return
+	}
+	var value any
+	if i, err := request.GetIntData(); err == nil {
+		value = i
+	} else {
+		value, _ = request.GetStringData()
+	}
+	keys := findByValue(name, toValueKey(value))
+	freeRLock()
+	for _, key := range keys {
+		out <- runtime.ConstructResponse(request, runtime.Ok, key)
+	}
+	out <- runtime.ConstructResponse(request, runtime.StreamDone, 0)
+}
+
 func ProcessStreamRequest(request runtime.Request) <-chan runtime.Response {
 	out := make(chan runtime.Response, streamBufferSize)
 
@@ -665,6 +1605,20 @@ func ProcessStreamRequest(request runtime.Request) <-chan runtime.Response {
 		go streamReadOperation(values, request, notFoundFilter, out)
 	case runtime.Items:
 		go streamReadOperation(items, request, notFoundFilter, out)
+	case runtime.MGet:
+		go mgetOperation(request, out)
+	case runtime.ScanPrefix, runtime.ScanRange:
+		go indexScanOperation(request, out)
+	case runtime.Scan:
+		go scanOperation(request, out)
+	case runtime.FindByValue:
+		go findByValueOperation(request, out)
+	case runtime.Stats:
+		go statsOperation(request, out)
+	case runtime.Explain:
+		go explainOperation(request, out)
+	case runtime.Export:
+		go exportOperation(request, out)
 	default:
 		panic("Unreachable")
 	}
@@ -0,0 +1,536 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// Open an empty store in a temporary directory for the test
+func openTestStore(t *testing.T) {
+	t.Helper()
+	runtime.UseStoreFile(filepath.Join(t.TempDir(), "store.bin"))
+	if err := OpenStore(); err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	t.Cleanup(indexReset)
+	// resize checks must finish with the test's store, not the next one's
+	t.Cleanup(pendingResizes.Wait)
+}
+
+// Build the request for a command, failing the test if it can't be built
+func construct(t *testing.T, args ...string) runtime.Request {
+	t.Helper()
+	request, err := runtime.ConstructRequest(args, false)
+	if err != nil {
+		t.Fatalf("ConstructRequest(%v): %v", args, err)
+	}
+	return request
+}
+
+func process(t *testing.T, args ...string) runtime.Response {
+	t.Helper()
+	return ProcessRequest(construct(t, args...))
+}
+
+// Process a stream command, returning the payload of each response before
+// the stream ends
+func processStream(t *testing.T, args ...string) []string {
+	t.Helper()
+	var payloads []string
+	for response := range ProcessStreamRequest(construct(t, args...)) {
+		switch response.GetStatus() {
+		case runtime.Ok:
+			payloads = append(payloads, response.DataPayload())
+		case runtime.StreamDone:
+		default:
+			t.Fatalf("%v gave %v", args, response)
+		}
+	}
+	return payloads
+}
+
+// Keys that all hash to the same slot of the minimum table
+func collidingKeys(n int) []string {
+	slots := make(map[int64][]string)
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("k%d", i)
+		slot := hashKey(key, minTableSpace)
+		slots[slot] = append(slots[slot], key)
+		if len(slots[slot]) == n {
+			return slots[slot]
+		}
+	}
+}
+
+// Process a command, failing the test if it doesn't finish in time
+func processWithin(t *testing.T, d time.Duration, args ...string) runtime.Response {
+	t.Helper()
+	request := construct(t, args...)
+	done := make(chan runtime.Response, 1)
+	go func() { done <- ProcessRequest(request) }()
+	select {
+	case response := <-done:
+		return response
+	case <-time.After(d):
+		t.Fatalf("%v blocked for over %s", args, d)
+	}
+	return nil
+}
+
+func TestFailedResizeReleasesLock(t *testing.T) {
+	openTestStore(t)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		process(t, "store", key, "1")
+	}
+	response := process(t, "resize", "5")
+	if response.GetStatus() != runtime.InvalidRequest {
+		t.Fatalf("resize below threshold gave %s", response.GetStatus())
+	}
+	response = processWithin(t, time.Second, "store", "f", "1")
+	if response.GetStatus() != runtime.Ok {
+		t.Errorf("store after failed resize gave %s", response.GetStatus())
+	}
+}
+
+func TestInsertsDoNotOutrunResize(t *testing.T) {
+	openTestStore(t)
+	// a run of inserts with no pause for the resize check between them
+	for i := range 500 {
+		key := fmt.Sprintf("k%d", i)
+		if response := process(t, "store", key, "1"); response.GetStatus() != runtime.Ok {
+			t.Fatalf("store %s gave %s", key, response.GetStatus())
+		}
+	}
+	if storeMetadata.entries != 500 {
+		t.Errorf("%d entries after 500 inserts", storeMetadata.entries)
+	}
+}
+
+func TestConcurrentInsertsShareResizes(t *testing.T) {
+	openTestStore(t)
+	requests := make(chan runtime.Request)
+	go func() {
+		defer close(requests)
+		for i := range 800 {
+			requests <- construct(t, "store", fmt.Sprintf("k%d", i), "1")
+		}
+	}()
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for range 8 {
+		wg.Go(func() {
+			for request := range requests {
+				if ProcessRequest(request).GetStatus() != runtime.Ok {
+					failed.Add(1)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if failed.Load() > 0 {
+		t.Fatalf("%d of 800 concurrent inserts failed", failed.Load())
+	}
+	// resizes racing on the temp file would lose or duplicate entries
+	fp, err := os.Open(runtime.Config.StorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	c, err := checkFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.problems) > 0 || c.set != 800 {
+		t.Errorf("%d set after concurrent inserts: %v", c.set, c.problems)
+	}
+}
+
+func TestTransactionReservesSpace(t *testing.T) {
+	openTestStore(t)
+	// more keys than the minimum table can probe for in one queued mset
+	args := []string{"mset"}
+	for i := range 100 {
+		args = append(args, fmt.Sprintf("k%d", i), "1")
+	}
+	queued := []runtime.Request{construct(t, args...), construct(t, "store", "x", "1")}
+	responses := ProcessTransaction(construct(t, "exec"), queued, nil)
+	for _, response := range responses[:len(responses)-1] {
+		if response.GetStatus() != runtime.Ok {
+			t.Fatalf("queued request in exec gave %s", response.GetStatus())
+		}
+	}
+	if storeMetadata.entries != 101 {
+		t.Errorf("%d entries after exec", storeMetadata.entries)
+	}
+}
+
+func TestExecReportsFailedCommands(t *testing.T) {
+	openTestStore(t)
+	process(t, "store", "a", "2147483647")
+	queued := []runtime.Request{
+		construct(t, "add", "a", "5"),
+		construct(t, "store", "b", "1"),
+		construct(t, "load", "b"),
+	}
+	exec := construct(t, "exec")
+	responses := ProcessTransaction(exec, queued, nil)
+	want := []runtime.Status{runtime.Failed, runtime.Ok, runtime.Ok, runtime.StreamDone}
+	if len(responses) != len(want) {
+		t.Fatalf("exec gave %d responses", len(responses))
+	}
+	for i, response := range responses {
+		if response.GetStatus() != want[i] || response.GetId() != exec.GetId() {
+			t.Errorf("exec result %d: %v", i, response)
+		}
+		// the client reads exec's results until one ends the stream
+		if ends := response.EndsStream(); ends != (i == len(responses)-1) {
+			t.Errorf("exec result %d ends the stream: %t", i, ends)
+		}
+	}
+}
+
+func TestTombstonesAreRehashed(t *testing.T) {
+	openTestStore(t)
+	// every clear leaves a tombstone a different key can't reuse
+	for i := range 200 {
+		key := fmt.Sprintf("k%d", i)
+		process(t, "store", key, "1")
+		if response := process(t, "clear", key); response.GetStatus() != runtime.Ok {
+			t.Fatalf("clear %s gave %s", key, response.GetStatus())
+		}
+	}
+	if storeMetadata.tableSpace != minTableSpace {
+		t.Errorf("table space %d after churn with no entries", storeMetadata.tableSpace)
+	}
+	fp, err := os.Open(runtime.Config.StorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	c, err := checkFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.tombstones != storeMetadata.tombstones {
+		t.Errorf(
+			"%d tombstones counted but %d in the file",
+			storeMetadata.tombstones,
+			c.tombstones,
+		)
+	}
+	if float64(c.tombstones)/float64(minTableSpace) > sizeUpThreshold {
+		t.Errorf("%d tombstones left in %d slots", c.tombstones, minTableSpace)
+	}
+}
+
+// Scan one batch from cursor, returning the next cursor & the keys found
+func scanBatch(t *testing.T, cursor int) (int, []string) {
+	t.Helper()
+	var next int
+	var keys []string
+	request := construct(t, "scan", strconv.Itoa(cursor), "count", "5")
+	for response := range ProcessStreamRequest(request) {
+		switch {
+		case response.GetStatus() != runtime.Ok:
+			if response.GetStatus() != runtime.StreamDone {
+				t.Fatalf("scan %d gave %s", cursor, response.GetStatus())
+			}
+		case keys == nil:
+			next, _ = strconv.Atoi(response.DataPayload())
+			keys = []string{}
+		default:
+			keys = append(keys, strings.Fields(response.DataPayload())[0])
+		}
+	}
+	return next, keys
+}
+
+func TestScanCursorSurvivesRestart(t *testing.T) {
+	openTestStore(t)
+	for i := range 30 {
+		process(t, "store", fmt.Sprintf("k%d", i), "1")
+	}
+	process(t, "resize", "400")
+	seen := make(map[string]bool)
+	cursor := 0
+	for range 100 {
+		next, keys := scanBatch(t, cursor)
+		for _, key := range keys {
+			if seen[key] {
+				t.Fatalf("%s returned twice; cursor %d restarted the scan", key, cursor)
+			}
+			seen[key] = true
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+		// a restart between batches must not invalidate the cursor
+		if err := OpenStore(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seen) != 30 {
+		t.Errorf("scan returned %d of 30 keys", len(seen))
+	}
+}
+
+func TestCursorRejectsSlotsPastField(t *testing.T) {
+	if _, err := makeCursor(3, 1<<cursorSlotBits-1); err != nil {
+		t.Errorf("last slot a cursor holds: %v", err)
+	}
+	if _, err := makeCursor(3, 1<<cursorSlotBits); err == nil {
+		t.Error("slot past the cursor field should be rejected")
+	}
+}
+
+// Sleep until the start of the next whole second, where a limit window of
+// whole seconds begins
+func sleepToNextSecond() {
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+}
+
+func TestLimitQuota(t *testing.T) {
+	openTestStore(t)
+	// every call must fall in the same window
+	sleepToNextSecond()
+	for _, want := range []string{"2", "1", "0"} {
+		response := process(t, "limit", "k", "3", "1")
+		if response.GetStatus() != runtime.Ok || response.DataPayload() != want {
+			t.Fatalf(
+				"allowed call gave %s with %s left; want %s",
+				response.GetStatus(),
+				response.DataPayload(),
+				want,
+			)
+		}
+	}
+	response := process(t, "limit", "k", "3", "1")
+	if response.GetStatus() != runtime.ConditionFailed || response.DataPayload() != "denied" {
+		t.Errorf("call over quota gave %v", response)
+	}
+	process(t, "store", "s", "text")
+	response = process(t, "limit", "s", "3", "3600")
+	if response.GetStatus() != runtime.InvalidRequest {
+		t.Errorf("limit of a string gave %s", response.GetStatus())
+	}
+}
+
+func TestLimitWindowExpires(t *testing.T) {
+	openTestStore(t)
+	sleepToNextSecond()
+	process(t, "limit", "k", "1", "1")
+	response := process(t, "limit", "k", "1", "1")
+	if response.GetStatus() != runtime.ConditionFailed {
+		t.Fatalf("call over quota gave %s", response.GetStatus())
+	}
+	sleepToNextSecond()
+	response = process(t, "limit", "k", "1", "1")
+	if response.GetStatus() != runtime.Ok || response.DataPayload() != "0" {
+		t.Errorf("first call of a new window gave %s", response.GetStatus())
+	}
+}
+
+func TestConditionalStores(t *testing.T) {
+	// each case runs against a store holding n = 5 & s = "text"
+	tests := map[string]struct {
+		command []string
+		status  runtime.Status
+		payload string
+		after   string // value of the key afterwards
+	}{
+		"cas match":           {[]string{"cas", "n", "5", "6"}, runtime.Ok, "1", "6"},
+		"cas mismatch":        {[]string{"cas", "n", "4", "6"}, runtime.ConditionFailed, "0", "5"},
+		"cas missing":         {[]string{"cas", "m", "5", "6"}, runtime.NotFound, "", ""},
+		"cas int against str": {[]string{"cas", "s", "5", "6"}, runtime.ConditionFailed, "0", "text"},
+		"cas str against int": {[]string{"cas", "n", "5x", "6"}, runtime.ConditionFailed, "0", "5"},
+		"cas string match":    {[]string{"cas", "s", "text", "new"}, runtime.Ok, "1", "new"},
+		"setnx missing":       {[]string{"setnx", "m", "1"}, runtime.Ok, "1", "1"},
+		"setnx present":       {[]string{"setnx", "n", "1"}, runtime.ConditionFailed, "0", "5"},
+		"setxx present":       {[]string{"setxx", "n", "1"}, runtime.Ok, "1", "1"},
+		"setxx missing":       {[]string{"setxx", "m", "1"}, runtime.NotFound, "", ""},
+		"getset present":      {[]string{"getset", "s", "1"}, runtime.Ok, "text", "1"},
+		"getset missing":      {[]string{"getset", "m", "1"}, runtime.NotFound, "", "1"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			openTestStore(t)
+			process(t, "store", "n", "5")
+			process(t, "store", "s", "text")
+			response := process(t, test.command...)
+			if response.GetStatus() != test.status || response.DataPayload() != test.payload {
+				t.Errorf("gave %s with %q", response.GetStatus(), response.DataPayload())
+			}
+			if after := process(t, "load", test.command[1]).DataPayload(); after != test.after {
+				t.Errorf("%s is %q afterwards; want %q", test.command[1], after, test.after)
+			}
+		})
+	}
+}
+
+func TestRenameLeavesTombstone(t *testing.T) {
+	openTestStore(t)
+	keys := collidingKeys(2)
+	process(t, "store", keys[0], "1")
+	process(t, "store", keys[1], "2")
+	if response := process(t, "rename", keys[0], "moved"); response.GetStatus() != runtime.Ok {
+		t.Fatalf("rename gave %s", response.GetStatus())
+	}
+	if response := process(t, "load", keys[0]); response.GetStatus() != runtime.NotFound {
+		t.Errorf("renamed key still loads as %s", response.DataPayload())
+	}
+	if data := process(t, "load", "moved").DataPayload(); data != "1" {
+		t.Errorf("moved key holds %q", data)
+	}
+	// the key probed past the old slot must stay reachable
+	if data := process(t, "load", keys[1]).DataPayload(); data != "2" {
+		t.Errorf("%s holds %q after the key before it moved", keys[1], data)
+	}
+	if storeMetadata.entries != 2 || storeMetadata.tombstones != 1 {
+		t.Errorf(
+			"%d entries & %d tombstones after rename",
+			storeMetadata.entries,
+			storeMetadata.tombstones,
+		)
+	}
+}
+
+func TestRenameNXOntoExistingKey(t *testing.T) {
+	openTestStore(t)
+	process(t, "store", "a", "1")
+	process(t, "store", "b", "2")
+	response := process(t, "renamenx", "a", "b")
+	if response.GetStatus() != runtime.ConditionFailed {
+		t.Errorf("renamenx onto a set key gave %s", response.GetStatus())
+	}
+	a, b := process(t, "load", "a").DataPayload(), process(t, "load", "b").DataPayload()
+	if a != "1" || b != "2" {
+		t.Errorf("a is %q & b is %q after refused renamenx", a, b)
+	}
+	if response = process(t, "rename", "a", "b"); response.GetStatus() != runtime.Ok {
+		t.Errorf("rename onto a set key gave %s", response.GetStatus())
+	}
+	if b = process(t, "load", "b").DataPayload(); b != "1" || storeMetadata.entries != 1 {
+		t.Errorf("b is %q with %d entries after rename", b, storeMetadata.entries)
+	}
+	if response = process(t, "rename", "missing", "c"); response.GetStatus() != runtime.NotFound {
+		t.Errorf("rename of a missing key gave %s", response.GetStatus())
+	}
+}
+
+func TestRenameUpdatesValueIndex(t *testing.T) {
+	openTestStore(t)
+	process(t, "createindex", "idx")
+	process(t, "store", "a", "5")
+	process(t, "rename", "a", "b")
+	if keys := processStream(t, "findbyvalue", "5", "idx"); !slices.Equal(keys, []string{"b"}) {
+		t.Errorf("findbyvalue after rename gave %v", keys)
+	}
+	if keys := processStream(t, "scanprefix", ""); !slices.Equal(keys, []string{"b"}) {
+		t.Errorf("key index after rename holds %v", keys)
+	}
+}
+
+// Command with the status it should give, its payload if Ok & the value of
+// its key afterwards
+type commandCase struct {
+	command []string
+	status  runtime.Status
+	payload string
+	after   string
+}
+
+// Run each case against a store holding s = "hello" & n = 5
+func runCommandCases(t *testing.T, tests map[string]commandCase) {
+	t.Helper()
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			openTestStore(t)
+			process(t, "store", "s", "hello")
+			process(t, "store", "n", "5")
+			response := process(t, test.command...)
+			if response.GetStatus() != test.status {
+				t.Fatalf("gave %v", response)
+			}
+			if test.status == runtime.Ok && response.DataPayload() != test.payload {
+				t.Errorf("gave %q; want %q", response.DataPayload(), test.payload)
+			}
+			if after := process(t, "load", test.command[1]).DataPayload(); after != test.after {
+				t.Errorf("%s is %q afterwards; want %q", test.command[1], after, test.after)
+			}
+		})
+	}
+}
+
+func TestStringCommands(t *testing.T) {
+	full := strings.Repeat("x", runtime.MaxStringLen-1)
+	runCommandCases(t, map[string]commandCase{
+		"append":            {[]string{"append", "s", "!"}, runtime.Ok, "6", "hello!"},
+		"append digits":     {[]string{"append", "s", "12"}, runtime.Ok, "7", "hello12"},
+		"append overflow":   {[]string{"append", "s", full}, runtime.InvalidRequest, "", "hello"},
+		"append to int":     {[]string{"append", "n", "x"}, runtime.InvalidRequest, "", "5"},
+		"append missing":    {[]string{"append", "m", "x"}, runtime.NotFound, "", ""},
+		"strlen":            {[]string{"strlen", "s"}, runtime.Ok, "5", "hello"},
+		"getrange":          {[]string{"getrange", "s", "1", "3"}, runtime.Ok, "ell", "hello"},
+		"getrange negative": {[]string{"getrange", "s", "-3", "-1"}, runtime.Ok, "llo", "hello"},
+		"getrange all":      {[]string{"getrange", "s", "0", "-1"}, runtime.Ok, "hello", "hello"},
+		"getrange clamped":  {[]string{"getrange", "s", "-10", "100"}, runtime.Ok, "hello", "hello"},
+		"getrange inverted": {[]string{"getrange", "s", "3", "1"}, runtime.Ok, "", "hello"},
+		"setrange":          {[]string{"setrange", "s", "1", "EL"}, runtime.Ok, "5", "hELlo"},
+		"setrange at end":   {[]string{"setrange", "s", "5", "!!"}, runtime.Ok, "7", "hello!!"},
+		"setrange past end": {[]string{"setrange", "s", "6", "!"}, runtime.InvalidRequest, "", "hello"},
+		"setrange overflow": {[]string{"setrange", "s", "2", full}, runtime.InvalidRequest, "", "hello"},
+	})
+}
+
+func TestArithmeticCommands(t *testing.T) {
+	runCommandCases(t, map[string]commandCase{
+		"mul":              {[]string{"mul", "n", "-3"}, runtime.Ok, "-15", "-15"},
+		"mul overflow":     {[]string{"mul", "n", "1000000000"}, runtime.InvalidRequest, "", "5"},
+		"div truncates":    {[]string{"div", "n", "2"}, runtime.Ok, "2", "2"},
+		"div by zero":      {[]string{"div", "n", "0"}, runtime.InvalidRequest, "", "5"},
+		"mod":              {[]string{"mod", "n", "3"}, runtime.Ok, "2", "2"},
+		"mod by zero":      {[]string{"mod", "n", "0"}, runtime.InvalidRequest, "", "5"},
+		"div string":       {[]string{"div", "s", "2"}, runtime.InvalidRequest, "", "hello"},
+		"div missing":      {[]string{"div", "m", "2"}, runtime.NotFound, "", ""},
+		"setmax":           {[]string{"setmax", "n", "9"}, runtime.Ok, "9", "9"},
+		"setmax smaller":   {[]string{"setmax", "n", "1"}, runtime.Ok, "5", "5"},
+		"setmin":           {[]string{"setmin", "n", "1"}, runtime.Ok, "1", "1"},
+		"and":              {[]string{"and", "n", "6"}, runtime.Ok, "4", "4"},
+		"or":               {[]string{"or", "n", "2"}, runtime.Ok, "7", "7"},
+		"xor":              {[]string{"xor", "n", "1"}, runtime.Ok, "4", "4"},
+		"incr":             {[]string{"incr", "n"}, runtime.Ok, "6", "6"},
+		"incr by":          {[]string{"incr", "n", "-10"}, runtime.Ok, "-5", "-5"},
+		"incr creates":     {[]string{"incr", "m"}, runtime.Ok, "1", "1"},
+		"incr creates by":  {[]string{"incr", "m", "4"}, runtime.Ok, "4", "4"},
+		"incr string":      {[]string{"incr", "s"}, runtime.InvalidRequest, "", "hello"},
+		"incr overflow":    {[]string{"incr", "n", "2147483647"}, runtime.InvalidRequest, "", "5"},
+		"sub past minimum": {[]string{"sub", "n", "-2147483648"}, runtime.InvalidRequest, "", "5"},
+	})
+}
+
+func TestDivisionOverflow(t *testing.T) {
+	openTestStore(t)
+	// the one quotient of 32-bit ints that doesn't fit in one
+	process(t, "store", "n", "-2147483648")
+	response := process(t, "div", "n", "-1")
+	if response.GetStatus() != runtime.InvalidRequest {
+		t.Errorf("MinInt32 / -1 gave %v", response)
+	}
+	if data := process(t, "load", "n").DataPayload(); data != "-2147483648" {
+		t.Errorf("n is %s after overflowing div", data)
+	}
+	if response := process(t, "mod", "n", "-1"); response.DataPayload() != "0" {
+		t.Errorf("MinInt32 %% -1 gave %v", response)
+	}
+}
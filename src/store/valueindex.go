@@ -0,0 +1,143 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+// Typed value used to look up keys in a value index
+type valueKey struct {
+	ValueType valueType
+	Int       int
+	Str       string
+}
+
+func entryValueKey(d decodedEntry) valueKey {
+	return valueKey{ValueType: d.ValueType, Int: d.Int, Str: d.Str}
+}
+
+func toValueKey(v any) valueKey {
+	switch d := v.(type) {
+	case int:
+		return valueKey{ValueType: typeInt, Int: d}
+	case string:
+		return valueKey{ValueType: typeString, Str: d}
+	}
+	panic("Unreachable")
+}
+
+// Reverse lookup from values to keys for keys starting with prefix
+type valueIndex struct {
+	prefix string
+	keys   map[valueKey]map[string]struct{} // keys holding each value
+	values map[string]valueKey              // current value of each key
+}
+
+func newValueIndex(prefix string) *valueIndex {
+	return &valueIndex{
+		prefix: prefix,
+		keys:   make(map[valueKey]map[string]struct{}),
+		values: make(map[string]valueKey),
+	}
+}
+
+func (v *valueIndex) remove(key string) {
+	old, ok := v.values[key]
+	if !ok {
+		return
+	}
+	delete(v.values, key)
+	delete(v.keys[old], key)
+	if len(v.keys[old]) == 0 {
+		delete(v.keys, old)
+	}
+}
+
+func (v *valueIndex) set(d decodedEntry) {
+	if !strings.HasPrefix(d.Key, v.prefix) {
+		return
+	}
+	v.remove(d.Key)
+	value := entryValueKey(d)
+	if v.keys[value] == nil {
+		v.keys[value] = make(map[string]struct{})
+	}
+	v.keys[value][d.Key] = struct{}{}
+	v.values[d.Key] = value
+}
+
+// Value indexes by name; guarded by the store mutex like the file
+var valueIndexes = make(map[string]*valueIndex)
+
+func valueIndexSet(d decodedEntry) {
+	for _, v := range valueIndexes {
+		v.set(d)
+	}
+}
+
+func valueIndexRemove(key string) {
+	for _, v := range valueIndexes {
+		v.remove(key)
+	}
+}
+
+// Drop indexed values but keep index definitions
+func valueIndexReset() {
+	for name, v := range valueIndexes {
+		valueIndexes[name] = newValueIndex(v.prefix)
+	}
+}
+
+// Read index definitions (name to key prefix) saved alongside the store
+func loadValueIndexes() error {
+	valueIndexes = make(map[string]*valueIndex)
+	b, err := os.ReadFile(runtime.Config.IndexPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var definitions map[string]string
+	if err := json.Unmarshal(b, &definitions); err != nil {
+		return err
+	}
+	for name, prefix := range definitions {
+		valueIndexes[name] = newValueIndex(prefix)
+	}
+	return nil
+}
+
+func saveValueIndexes() error {
+	definitions := make(map[string]string, len(valueIndexes))
+	for name, v := range valueIndexes {
+		definitions[name] = v.prefix
+	}
+	b, err := json.Marshal(definitions)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(runtime.Config.IndexPath, b, 0644)
+}
+
+// Keys holding the value in the named index, or in every index if no name
+// is given, in sorted order
+func findByValue(name string, value valueKey) []string {
+	var found []string
+	for indexName, v := range valueIndexes {
+		if name != "" && name != indexName {
+			continue
+		}
+		for key := range v.keys[value] {
+			found = append(found, key)
+		}
+	}
+	slices.Sort(found)
+	return slices.Compact(found)
+}
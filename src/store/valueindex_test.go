@@ -0,0 +1,80 @@
+package store
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/EnemigoPython/go-getit/src/runtime"
+)
+
+func TestValueIndexFollowsWrites(t *testing.T) {
+	openTestStore(t)
+	process(t, "createindex", "all")
+	process(t, "createindex", "users", "user:")
+	process(t, "store", "user:a", "5")
+	process(t, "store", "b", "5")
+	process(t, "copy", "user:a", "user:c")
+	process(t, "store", "user:d", "4")
+	process(t, "add", "user:d", "1")
+	process(t, "store", "user:e", "5")
+	process(t, "clear", "user:e")
+	process(t, "store", "user:f", "5")
+	process(t, "rename", "user:f", "g")
+
+	tests := map[string][]string{
+		"all":   {"b", "g", "user:a", "user:c", "user:d"},
+		"users": {"user:a", "user:c", "user:d"},
+	}
+	for name, want := range tests {
+		keys := processStream(t, "findbyvalue", "5", name)
+		if !slices.Equal(keys, want) {
+			t.Errorf("findbyvalue 5 in %s gave %v; want %v", name, keys, want)
+		}
+	}
+	// without a name every index is searched, each key found once
+	if keys := processStream(t, "findbyvalue", "5"); !slices.Equal(keys, tests["all"]) {
+		t.Errorf("findbyvalue 5 in every index gave %v", keys)
+	}
+	if keys := processStream(t, "findbyvalue", "4"); len(keys) != 0 {
+		t.Errorf("old value of an updated key still indexed for %v", keys)
+	}
+}
+
+func TestValueIndexIndexesExistingKeys(t *testing.T) {
+	openTestStore(t)
+	process(t, "store", "user:a", "x")
+	process(t, "store", "b", "x")
+	response := process(t, "createindex", "users", "user:")
+	if response.GetStatus() != runtime.Ok {
+		t.Fatalf("createindex gave %v", response)
+	}
+	keys := processStream(t, "findbyvalue", "x", "users")
+	if !slices.Equal(keys, []string{"user:a"}) {
+		t.Errorf("findbyvalue in a new prefix index gave %v", keys)
+	}
+	if response := process(t, "createindex", "users"); response.GetStatus() != runtime.InvalidRequest {
+		t.Errorf("createindex of an existing name gave %s", response.GetStatus())
+	}
+}
+
+func TestValueIndexesRebuiltOnOpen(t *testing.T) {
+	openTestStore(t)
+	process(t, "createindex", "users", "user:")
+	process(t, "createindex", "dropped")
+	process(t, "store", "user:a", "5")
+	process(t, "store", "b", "5")
+	process(t, "dropindex", "dropped")
+
+	// definitions are read back from the index file & values from the table
+	if err := OpenStore(); err != nil {
+		t.Fatal(err)
+	}
+	keys := processStream(t, "findbyvalue", "5", "users")
+	if !slices.Equal(keys, []string{"user:a"}) {
+		t.Errorf("findbyvalue after reopening gave %v", keys)
+	}
+	if _, ok := valueIndexes["dropped"]; ok || len(valueIndexes) != 1 {
+		t.Errorf("indexes after reopening: %v", slices.Collect(maps.Keys(valueIndexes)))
+	}
+}